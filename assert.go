@@ -45,3 +45,124 @@ func equals(t TestingTB, expected, actual any, extra ...any) {
 func format(val any) string {
 	return fmt.Sprintf("%v", val)
 }
+
+// firstDifference returns the index of the first byte at which a and b differ,
+// or -1 if they are equal.
+func firstDifference(a, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	if len(a) < len(b) {
+		return len(a)
+	}
+
+	if len(b) < len(a) {
+		return len(b)
+	}
+
+	return -1
+}
+
+// excerptRadius is how much context excerpt includes either side of a position.
+const excerptRadius = 40
+
+// excerpt returns the part of s surrounding index i for failure messages.
+func excerpt(s string, i int) string {
+	from, to := i-excerptRadius, i+excerptRadius
+
+	if from < 0 {
+		from = 0
+	}
+
+	if to > len(s) {
+		to = len(s)
+	}
+
+	if from > to {
+		return ""
+	}
+
+	return fmt.Sprintf("%q", s[from:to])
+}
+
+// structDiff describes where expected and actual differ, with one line per
+// differing exported struct field. Both must be of the same type. Values with an
+// Equal method, e.g. time.Time, are compared with it, and structs with
+// unexported fields are compared as a whole.
+func structDiff(path string, expected, actual reflect.Value) []string {
+	diff := make([]string, 0)
+
+	if equal, hasEqual := equalMethod(expected, actual); hasEqual {
+		if !equal {
+			diff = append(diff, fmt.Sprintf("%s: expected %s, actual %s", path, formatValue(expected), formatValue(actual)))
+		}
+
+		return diff
+	}
+
+	switch expected.Kind() {
+	case reflect.Pointer:
+		if !expected.IsNil() && !actual.IsNil() {
+			return structDiff(path, expected.Elem(), actual.Elem())
+		}
+	case reflect.Struct:
+		if hasUnexportedFields(expected.Type()) {
+			break
+		}
+
+		for i := 0; i < expected.NumField(); i++ {
+			diff = append(diff, structDiff(path+"."+expected.Type().Field(i).Name, expected.Field(i), actual.Field(i))...)
+		}
+
+		return diff
+	}
+
+	if !reflect.DeepEqual(expected.Interface(), actual.Interface()) {
+		diff = append(diff, fmt.Sprintf("%s: expected %s, actual %s", path, formatValue(expected), formatValue(actual)))
+	}
+
+	return diff
+}
+
+// equalMethod compares expected and actual with expected's Equal method, if it
+// has one of the form func (T) Equal(T) bool.
+func equalMethod(expected, actual reflect.Value) (equal bool, hasEqual bool) {
+	if expected.Kind() == reflect.Pointer {
+		return false, false
+	}
+
+	method := expected.MethodByName("Equal")
+	if !method.IsValid() {
+		return false, false
+	}
+
+	if method.Type().NumIn() != 1 || method.Type().In(0) != expected.Type() ||
+		method.Type().NumOut() != 1 || method.Type().Out(0).Kind() != reflect.Bool {
+		return false, false
+	}
+
+	return method.Call([]reflect.Value{actual})[0].Bool(), true
+}
+
+// hasUnexportedFields reports whether struct type typ has any unexported fields.
+func hasUnexportedFields(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		if !typ.Field(i).IsExported() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatValue formats val for failure messages, dereferencing non-nil pointers.
+func formatValue(val reflect.Value) string {
+	if val.Kind() == reflect.Pointer && !val.IsNil() {
+		return "&" + formatValue(val.Elem())
+	}
+
+	return fmt.Sprintf("%#v", val.Interface())
+}
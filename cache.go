@@ -0,0 +1,66 @@
+package httptester
+
+// Assertions against HTTP caching behaviour.
+
+import (
+	"net/http"
+	"strings"
+)
+
+// cacheableStatuses are the status codes which are cacheable by default, as per
+// RFC 9110 section 15.1.
+var cacheableStatuses = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusPartialContent:       true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// ExpectCacheable asserts that the response may be stored by shared caches such
+// as CDNs: it has a cacheable status code, a Cache-Control header which does
+// not forbid storing it, and does not set cookies. All violated rules are
+// reported together.
+func (h *HttpTester) ExpectCacheable() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			violations := make([]string, 0)
+
+			if !cacheableStatuses[response.StatusCode] {
+				violations = append(violations, "status "+response.Status+" is not cacheable")
+			}
+
+			cacheControl := response.Header.Values("Cache-Control")
+			if len(cacheControl) == 0 {
+				violations = append(violations, "missing Cache-Control header")
+			}
+
+			for _, directive := range strings.Split(strings.Join(cacheControl, ","), ",") {
+				name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+				if strings.EqualFold(name, "no-store") || strings.EqualFold(name, "private") {
+					violations = append(violations, "Cache-Control forbids caching: "+strings.Join(cacheControl, ", "))
+					break
+				}
+			}
+
+			if len(response.Header.Values("Set-Cookie")) > 0 {
+				violations = append(violations, "response sets cookies")
+			}
+
+			if len(violations) > 0 {
+				args := []any{strings.Join(violations, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response is not cacheable", args...)
+			}
+		})
+	}
+}
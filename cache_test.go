@@ -0,0 +1,41 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"testing"
+)
+
+func TestExpectCacheable(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if cacheControl := request.URL.Query().Get("cc"); cacheControl != "" {
+			writer.Header().Set("Cache-Control", cacheControl)
+		}
+		if request.URL.Query().Has("cookie") {
+			http.SetCookie(writer, &http.Cookie{Name: "session", Value: "abc"})
+		}
+		if request.URL.Query().Has("error") {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?cc=public,max-age=60").Expect(ht.ExpectCacheable()).Test()
+	})
+
+	expectFailure(t, "missing Cache-Control header", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectCacheable()).Test()
+	})
+
+	expectFailure(t, "Cache-Control forbids caching: no-store", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?cc=no-store").Expect(ht.ExpectCacheable()).Test()
+	})
+
+	expectFailure(t, "status 500 Internal Server Error is not cacheable\nresponse sets cookies", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?cc=max-age=60&cookie&error").Expect(ht.ExpectCacheable()).Test()
+	})
+}
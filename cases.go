@@ -0,0 +1,69 @@
+package httptester
+
+// Support for table-driven tests.
+
+import (
+	"testing"
+)
+
+// HttpCase describes a request and its expectations for RunCases.
+type HttpCase struct {
+	// Name identifies the case, and names its subtest.
+	Name    string
+	Method  string
+	Path    string
+	Options []RequestOption
+	Expect  []ResponseOption
+}
+
+// RunCases tests each of cases in turn, returning their captures keyed by case
+// name. Each case runs in its own subtest if supported, as per subtest. E.g.:
+//
+//	ht.RunCases([]httptester.HttpCase{
+//		{Name: "create", Method: "POST", Path: "/items", Expect: []httptester.ResponseOption{ht.ExpectCode(201)}},
+//		{Name: "missing", Method: "GET", Path: "/items/0", Expect: []httptester.ResponseOption{ht.ExpectCode(404)}},
+//	})
+func (h *HttpTester) RunCases(cases []HttpCase) map[string]map[string]string {
+	h.t.Helper()
+
+	captures := make(map[string]map[string]string, len(cases))
+
+	for _, c := range cases {
+		c := c
+
+		h.subtest(c.Name, func() {
+			h.t.Helper()
+
+			captures[c.Name] = h.Request(c.Method, c.Path, c.Options...).Expect(c.Expect...).Test("case", c.Name)
+		})
+	}
+
+	return captures
+}
+
+// subtestRunner is implemented by a TestingTB which supports subtests, such as
+// *testing.T.
+type subtestRunner interface {
+	Run(name string, f func(t *testing.T)) bool
+}
+
+// subtest calls fn in a subtest of the given name, during which this tester
+// reports to the subtest. If the tester's TestingTB does not support subtests,
+// fn is called directly.
+func (h *HttpTester) subtest(name string, fn func()) {
+	h.t.Helper()
+
+	runner, isRunner := h.t.(subtestRunner)
+	if !isRunner {
+		fn()
+		return
+	}
+
+	t := h.t
+	defer func() { h.t = t }()
+
+	runner.Run(name, func(subT *testing.T) {
+		h.t = subT
+		fn()
+	})
+}
@@ -0,0 +1,30 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"testing"
+)
+
+func TestRunCases(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/missing" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = writer.Write([]byte(`{"method":"` + request.Method + `"}`))
+	})
+
+	ht := newTester(t, handler)
+
+	captures := ht.RunCases([]httptester.HttpCase{
+		{Name: "get", Method: "GET", Path: "/", Expect: []httptester.ResponseOption{ht.ExpectCode(200), ht.CaptureJson("method", "$.method")}},
+		{Name: "post", Method: "POST", Path: "/", Expect: []httptester.ResponseOption{ht.ExpectCode(200), ht.CaptureJson("method", "$.method")}},
+		{Name: "missing", Method: "GET", Path: "/missing", Expect: []httptester.ResponseOption{ht.ExpectCode(404)}},
+	})
+
+	if len(captures) != 3 || captures["get"]["method"] != "GET" || captures["post"]["method"] != "POST" {
+		t.Errorf("unexpected captures: %v", captures)
+	}
+}
@@ -0,0 +1,143 @@
+package httptester
+
+// Support for request and response compression.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Gzip configures a HttpTesterRequest to send its body gzip-compressed, with
+// "Content-Encoding: gzip". The body is compressed once the request is complete,
+// so this may be given before or after the option which sets the body.
+func (h *HttpTester) Gzip() RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.gzip = true
+		req.request.Header.Set("Content-Encoding", "gzip")
+	}
+}
+
+// gzipBody compresses the buffered body of a finalised request.
+func (h *HttpTesterRequest) gzipBody(extra ...any) {
+	t := h.tester.t
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+
+	_, err := writer.Write(h.body)
+	must(t, err, extra...)
+	must(t, writer.Close(), extra...)
+
+	h.body = buf.Bytes()
+}
+
+// KeepCompressed configures a HttpExpectation to assert against the response
+// body as sent by the server. By default, a gzip-encoded response body is
+// decompressed as it is read, so expectations, captures and limits such as
+// ExpectMaxBodySize apply to the decompressed body.
+func (h *HttpTester) KeepCompressed() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.keepCompressed = true
+	}
+}
+
+// decompress returns a reader which decompresses body, that of a gzip-encoded
+// response, as it is read. The response's encoding headers are removed, as the
+// http.Client would had it requested the compression itself. Other response
+// bodies are returned as is.
+//
+// The gzip stream is not read until the first read, so this does not block on
+// a response which is slow to start.
+func decompress(response *http.Response, body io.Reader) io.Reader {
+	if !strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+		return body
+	}
+
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+
+	return &gzipReader{body: body}
+}
+
+// gzipReader decompresses body as it is read.
+type gzipReader struct {
+	body   io.Reader
+	reader *gzip.Reader
+}
+
+func (g *gzipReader) Read(p []byte) (int, error) {
+	if g.reader == nil {
+		reader, err := gzip.NewReader(g.body)
+		if err != nil {
+			return 0, fmt.Errorf("cannot decompress gzip response body: %w", err)
+		}
+		g.reader = reader
+	}
+
+	n, err := g.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("cannot decompress gzip response body: %w", err)
+	}
+
+	return n, err
+}
+
+// ExpectCompressionNegotiation asserts that the server compresses its response
+// only when the client accepts it. The request is sent again twice: once with
+// "Accept-Encoding: gzip", which must receive a smaller, gzip-encoded body, and
+// once with "Accept-Encoding: identity", which must receive a body with no
+// Content-Encoding. The gzip body must decompress to the identity body.
+func (h *HttpTester) ExpectCompressionNegotiation() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			// Setting Accept-Encoding explicitly stops the client from
+			// transparently decompressing, so we see the raw bodies.
+			gzipReq := expectation.request.build()
+			gzipReq.Header.Set("Accept-Encoding", "gzip")
+			gzipResp, compressed, _ := expectation.request.send(t, gzipReq, false, nil, extra...)
+
+			identityReq := expectation.request.build()
+			identityReq.Header.Set("Accept-Encoding", "identity")
+			identityResp, uncompressed, _ := expectation.request.send(t, identityReq, false, nil, extra...)
+
+			if encoding := identityResp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+				args := []any{"Content-Encoding", encoding}
+				args = append(args, extra...)
+				fatal(t, "response is encoded when the client does not accept it", args...)
+			}
+
+			if encoding := gzipResp.Header.Get("Content-Encoding"); encoding != "gzip" {
+				args := []any{"Content-Encoding", encoding}
+				args = append(args, extra...)
+				fatal(t, "response is not gzip encoded when the client accepts it", args...)
+			}
+
+			if len(compressed) >= len(uncompressed) {
+				args := []any{"gzip size", len(compressed), "identity size", len(uncompressed)}
+				args = append(args, extra...)
+				fatal(t, "compressed response is not smaller than uncompressed", args...)
+			}
+
+			reader, err := gzip.NewReader(strings.NewReader(compressed))
+			must(t, err, append([]any{"failed to decompress gzip response"}, extra...)...)
+
+			decompressed, err := io.ReadAll(reader)
+			must(t, err, append([]any{"failed to decompress gzip response"}, extra...)...)
+
+			if i := firstDifference(uncompressed, string(decompressed)); i >= 0 {
+				args := []any{"offset", i, "identity", excerpt(uncompressed, i), "gzip", excerpt(string(decompressed), i)}
+				args = append(args, extra...)
+				fatal(t, "decompressed response differs from uncompressed", args...)
+			}
+		})
+	}
+}
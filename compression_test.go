@@ -0,0 +1,105 @@
+package httptester_test
+
+import (
+	"compress/gzip"
+	"github.com/vaeryn-uk/go-httptester"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExpectCompressionNegotiation(t *testing.T) {
+	content := strings.Repeat("compress me ", 100)
+
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Accept-Encoding") != "gzip" && !request.URL.Query().Has("always") {
+			_, _ = writer.Write([]byte(content))
+			return
+		}
+
+		writer.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(writer)
+		_, _ = gz.Write([]byte(content))
+		_ = gz.Close()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectCompressionNegotiation()).Test()
+	})
+
+	expectFailure(t, "response is encoded when the client does not accept it", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?always").Expect(ht.ExpectCompressionNegotiation()).Test()
+	})
+
+	expectFailure(t, "response is not gzip encoded when the client accepts it", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("GET", "/").Expect(ht.ExpectCompressionNegotiation()).Test()
+	})
+}
+
+func TestGzip(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Content-Encoding") != "gzip" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		reader, err := gzip.NewReader(request.Body)
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, _ = io.Copy(writer, reader)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.Gzip(), ht.JsonBody(map[string]any{"a": 1})).
+			Expect(ht.ExpectCode(200), ht.ExpectJsonMatch("$.a", 1)).
+			Test()
+	})
+}
+
+func TestDecompressesResponses(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(writer)
+		_, _ = gz.Write([]byte(`{"a":"compressed"}`))
+		_ = gz.Close()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.Header("Accept-Encoding", "gzip")).
+			Expect(ht.ExpectJsonMatch("$.a", "compressed"), ht.ExpectFunc(func(t httptester.TestingTB, response *http.Response, body string) {
+				if response.Header.Get("Content-Encoding") != "" || response.ContentLength != -1 || !response.Uncompressed {
+					t.Fatal("expected the response to be marked as decompressed")
+				}
+			})).
+			Test()
+	})
+
+	// The decompressed response is included in failures.
+	expectFailure(t, `"a": "compressed"`, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.Header("Accept-Encoding", "gzip")).
+			Expect(ht.ExpectJsonMatch("$.a", "decompressed")).
+			Test()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.Header("Accept-Encoding", "gzip")).
+			Expect(ht.KeepCompressed(), ht.ExpectFunc(func(t httptester.TestingTB, response *http.Response, body string) {
+				if !strings.HasPrefix(body, "\x1f\x8b") {
+					t.Fatal("expected a gzip body")
+				}
+			})).
+			Test()
+	})
+}
@@ -0,0 +1,54 @@
+package httptester
+
+// Support for conditional requests, e.g. optimistic updates via ETags.
+
+import (
+	"net/http"
+)
+
+// CaptureETag captures the response's ETag header under name, failing if the
+// response has none. See IfMatchCaptured.
+func (h *HttpTester) CaptureETag(name string) ResponseOption {
+	return h.CaptureHeader(name, "ETag")
+}
+
+// IfMatch configures a HttpTesterRequest with an If-Match header, so that the
+// server only applies it if the resource's current ETag is etag.
+func (h *HttpTester) IfMatch(etag string) RequestOption {
+	return h.Header("If-Match", etag)
+}
+
+// IfMatchCaptured is like IfMatch, using an ETag captured by an earlier request
+// on this HttpTester via CaptureETag. E.g.:
+//
+//	ht.Request("GET", "/users/1").Expect(ht.CaptureETag("etag")).Test()
+//	ht.Request("PUT", "/users/1", ht.IfMatchCaptured("etag"), ht.JsonBody(user)).Expect(ht.ExpectCode(200)).Test()
+func (h *HttpTester) IfMatchCaptured(captureName string) RequestOption {
+	return func(req *HttpTesterRequest) {
+		h.t.Helper()
+
+		etag, exists := h.captures[captureName]
+		if !exists {
+			fatal(h.t, "no ETag has been captured with this name", captureName)
+			return
+		}
+
+		req.request.Header.Set("If-Match", etag)
+	}
+}
+
+// TestConditionalUpdate immediately tests a read-modify-write of the resource at
+// path, as a client using optimistic concurrency would. A GET reads the
+// resource's ETag, then a PUT configured by opts is sent with that ETag in
+// If-Match, which must succeed with a 2xx status.
+func (h *HttpTester) TestConditionalUpdate(path string, opts ...RequestOption) {
+	h.t.Helper()
+
+	hasETag := h.expectHeaderValue("ETag", "response does not have an ETag", func(actual string) bool {
+		return actual != ""
+	})
+	get := h.Request(http.MethodGet, path).Expect(hasETag).TestResponse("conditional update GET")
+
+	opts = append(opts, h.IfMatch(get.Header.Get("ETag")))
+	h.Request(http.MethodPut, path, opts...).Expect(h.ExpectSuccess()).Test("conditional update PUT")
+}
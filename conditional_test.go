@@ -0,0 +1,50 @@
+package httptester_test
+
+import (
+	"fmt"
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConditionalUpdate(t *testing.T) {
+	version := 1
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version)
+		if request.Method == http.MethodPut {
+			if request.Header.Get("If-Match") != etag {
+				writer.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			version++
+			etag = fmt.Sprintf(`"v%d"`, version)
+		}
+		if !strings.HasSuffix(request.URL.Path, "/untagged") {
+			writer.Header().Set("ETag", etag)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestConditionalUpdate("/users/1", ht.JsonBody(`{"name":"Scotty"}`))
+
+		if captures := ht.Captures(); len(captures) != 0 {
+			t.Errorf("conditional update leaked captures: %v", captures)
+		}
+
+		ht.Request("GET", "/users/1").Expect(ht.CaptureETag("etag")).Test()
+		ht.Request("PUT", "/users/1", ht.IfMatchCaptured("etag")).Expect(ht.ExpectCode(200)).Test()
+		ht.Request("PUT", "/users/1", ht.IfMatchCaptured("etag")).Expect(ht.ExpectCode(412)).Test()
+	})
+
+	expectFailure(t, "response does not have an ETag", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestConditionalUpdate("/users/untagged")
+	})
+
+	expectFailure(t, "no ETag has been captured with this name", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("PUT", "/users/1", ht.IfMatchCaptured("etag")).Expect().Test()
+	})
+}
@@ -0,0 +1,66 @@
+package httptester
+
+// Assertions against CSV response bodies.
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ExpectCSVHeader asserts that the HTTP response has a CSV body whose first
+// row is exactly columns.
+func (h *HttpTester) ExpectCSVHeader(columns ...string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			rows := parseCsv(t, body, extra...)
+			if len(rows) == 0 {
+				fatal(t, "CSV body has no header row", extra...)
+				return
+			}
+
+			equals(t, columns, rows[0], append([]any{"CSV header"}, extra...)...)
+		})
+	}
+}
+
+// ExpectCSVRowCount asserts that the HTTP response has a CSV body with n rows,
+// not including the header row.
+func (h *HttpTester) ExpectCSVRowCount(n int) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			rows := parseCsv(t, body, extra...)
+			if len(rows) == 0 {
+				fatal(t, "CSV body has no header row", extra...)
+				return
+			}
+
+			equals(t, n, len(rows)-1, append([]any{"CSV row count"}, extra...)...)
+		})
+	}
+}
+
+// parseCsv fatals the test if body cannot be parsed as CSV, reporting the
+// offending line. Returns all parsed rows.
+func parseCsv(t TestingTB, body string, extra ...any) [][]string {
+	t.Helper()
+
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		lines := strings.Split(body, "\n")
+		if parseErr.Line > 0 && parseErr.Line <= len(lines) {
+			extra = append([]any{"line", lines[parseErr.Line-1]}, extra...)
+		}
+	}
+
+	must(t, err, append([]any{"failed to parse CSV body"}, extra...)...)
+
+	return rows
+}
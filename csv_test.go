@@ -0,0 +1,20 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body("id,name\n1,a\n2,b\n")).
+			Expect(ht.ExpectCSVHeader("id", "name"), ht.ExpectCSVRowCount(2)).
+			Test()
+	})
+
+	expectFailure(t, `2,"b`, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body("id,name\n2,\"b\n")).Expect(ht.ExpectCSVRowCount(1)).Test()
+	})
+}
@@ -0,0 +1,90 @@
+package httptester
+
+// Support for testing eventually-consistent behaviour.
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// TestEventually is like Test, but repeatedly sends the request every interval
+// until its expectations and captures all pass, or timeout elapses. Only the
+// final attempt can fail the test. Returns the captures of the passing attempt.
+//
+// This is useful for waiting on background work, e.g.:
+//
+//	ht.Request("GET", "/jobs/1").
+//		Expect(ht.ExpectJsonMatch("$.status", "done")).
+//		TestEventually(5*time.Second, 100*time.Millisecond)
+func (h *HttpExpectation) TestEventually(timeout, interval time.Duration, extra ...any) (captures map[string]string) {
+	tester := h.request.tester
+	tester.t.Helper()
+
+	h.request.done = true
+
+	// If the subtest fails, callers still receive empty captures.
+	captures = map[string]string{}
+
+	h.request.named(func() {
+		tester.t.Helper()
+
+		captures = h.testEventually(timeout, interval, extra...)
+	})
+
+	return captures
+}
+
+// testEventually finalises the request and tests it until it passes, as per
+// TestEventually.
+func (h *HttpExpectation) testEventually(timeout, interval time.Duration, extra ...any) map[string]string {
+	h.request.tester.t.Helper()
+
+	h.request.finalise(extra...)
+
+	deadline := time.Now().Add(timeout)
+	attempts := 1
+
+	for ; time.Now().Add(interval).Before(deadline); attempts++ {
+		if result := h.tryAttempt(extra...); result != nil {
+			h.request.passed = true
+			return result.Captures
+		}
+
+		time.Sleep(interval)
+	}
+
+	extra = append(extra, fmt.Sprintf("after %d attempts over %s", attempts, timeout))
+	result := h.attempt(h.request.tester.t, extra...)
+
+	h.request.passed = true
+
+	return result.Captures
+}
+
+// tryAttempt is like attempt, but returns nil instead of failing the test.
+func (h *HttpExpectation) tryAttempt(extra ...any) (result *HttpExpectationResult) {
+	t := &attemptTB{TestingTB: h.request.tester.t}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		result = h.attempt(t, extra...)
+	}()
+
+	<-done
+
+	return result
+}
+
+// attemptTB wraps a TestingTB for an attempt which is allowed to fail. Fatal
+// ends the attempt without failing the test, and logs are discarded.
+type attemptTB struct {
+	TestingTB
+}
+
+func (a *attemptTB) Fatal(args ...any) {
+	runtime.Goexit()
+}
+
+func (a *attemptTB) Log(args ...any) {}
@@ -0,0 +1,84 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTestEventually(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mu.Lock()
+		calls++
+		status := "pending"
+		if calls >= 3 {
+			status = "done"
+		}
+		mu.Unlock()
+
+		_, _ = writer.Write([]byte(`{"status":"` + status + `"}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		captures := ht.Request("GET", "/job").
+			Expect(ht.ExpectJsonMatch("$.status", "done"), ht.CaptureJson("status", "$.status")).
+			TestEventually(time.Second, 10*time.Millisecond)
+
+		if captures["status"] != "done" {
+			t.Errorf("expected final capture, got %v", captures)
+		}
+	})
+
+	mu.Lock()
+	calls = -1000
+	mu.Unlock()
+
+	expectFailure(t, "attempts over", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/job").
+			Expect(ht.ExpectJsonMatch("$.status", "done")).
+			TestEventually(50*time.Millisecond, 10*time.Millisecond)
+	})
+
+	// Other requests on the same tester fail as normal during the attempts.
+	var served int32
+	slowHandler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/other" {
+			atomic.StoreInt32(&served, 1)
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		status := "pending"
+		if atomic.LoadInt32(&served) == 1 {
+			status = "done"
+		}
+		_, _ = writer.Write([]byte(`{"status":"` + status + `"}`))
+	})
+
+	expectFailure(t, "concurrent request", func(tb httptester.TestingTB) {
+		ht := newTester(tb, slowHandler)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			time.Sleep(30 * time.Millisecond)
+			ht.Request("GET", "/other").Expect(ht.ExpectCode(200)).Test("concurrent request")
+		}()
+
+		ht.Request("GET", "/job").
+			Expect(ht.ExpectJsonMatch("$.status", "done")).
+			TestEventually(time.Second, time.Millisecond)
+
+		<-done
+	})
+}
@@ -5,6 +5,20 @@ go 1.19
 require (
 	github.com/PaesslerAG/gval v1.2.1
 	github.com/PaesslerAG/jsonpath v0.1.1
+	github.com/antchfx/xmlquery v1.3.5
+	github.com/ghodss/yaml v1.0.0
+	github.com/gorilla/websocket v1.5.0
+	github.com/xeipuuv/gojsonschema v1.2.0
+	google.golang.org/protobuf v1.34.1
 )
 
-require github.com/shopspring/decimal v1.3.1 // indirect
+require (
+	github.com/antchfx/xpath v1.1.10 // indirect
+	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/shopspring/decimal v1.3.1 // indirect
+	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f // indirect
+	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
+	golang.org/x/net v0.12.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
@@ -0,0 +1,74 @@
+package httptester
+
+// Support for comparing responses against golden files on disk.
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UpdateGoldenFiles, when true, causes golden file expectations to write the
+// actual response to the golden file instead of comparing against it. This is
+// typically wired to a flag in a test package, e.g.:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+//	func TestMain(m *testing.M) {
+//		flag.Parse()
+//		httptester.UpdateGoldenFiles = *update
+//		os.Exit(m.Run())
+//	}
+var UpdateGoldenFiles = false
+
+// ExpectJsonEqualsFileExcept asserts that the HTTP response has a JSON body which
+// is equal to the JSON in the file at path, typically in testdata. Values at
+// each of ignorePaths are removed from both sides before comparing, so that
+// volatile values such as IDs and timestamps do not cause failures.
+//
+// ignorePaths only support simple JSONPath child steps, e.g. $.id, $.items[*].createdAt.
+//
+// If UpdateGoldenFiles is set, the file at path is instead (re)written with the
+// response JSON, with ignorePaths removed.
+func (h *HttpTester) ExpectJsonEqualsFileExcept(path string, ignorePaths ...string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			actual := MustParseJson[any](t, strings.NewReader(body), extra...)
+			actual = scrubJson(t, actual, ignorePaths, extra...)
+
+			if UpdateGoldenFiles {
+				writeGoldenJson(t, path, actual, extra...)
+				return
+			}
+
+			data, err := os.ReadFile(path)
+			must(t, err, append([]any{"failed to read golden file"}, extra...)...)
+
+			expected := MustParseJson[any](t, bytes.NewReader(data), append([]any{"golden file", path}, extra...)...)
+			expected = scrubJson(t, expected, ignorePaths, extra...)
+
+			if diff := jsonDiff("$", expected, actual); len(diff) > 0 {
+				args := []any{"golden file", path, "diff", strings.Join(diff, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response JSON does not match golden file", args...)
+			}
+		})
+	}
+}
+
+// writeGoldenJson writes data as indented JSON to the file at path, creating any
+// missing directories.
+func writeGoldenJson(t TestingTB, path string, data any, extra ...any) {
+	t.Helper()
+
+	b, err := json.MarshalIndent(data, "", "  ")
+	must(t, err, extra...)
+
+	must(t, os.MkdirAll(filepath.Dir(path), 0o755), extra...)
+	must(t, os.WriteFile(path, append(b, '\n'), 0o644), extra...)
+}
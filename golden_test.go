@@ -0,0 +1,41 @@
+package httptester_test
+
+import (
+	"fmt"
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpectJsonEqualsFileExcept(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(writer, `{"id":%q,"items":[{"name":"a","at":%q}]}`, request.URL.Query().Get("id"), time.Now())
+	})
+
+	golden := filepath.Join(t.TempDir(), "testdata", "golden.json")
+
+	httptester.UpdateGoldenFiles = true
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?id=1").Expect(ht.ExpectJsonEqualsFileExcept(golden, "$.items[*].at")).Test()
+	})
+	httptester.UpdateGoldenFiles = false
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?id=1").Expect(ht.ExpectJsonEqualsFileExcept(golden, "$.items[*].at")).Test()
+	})
+
+	expectFailure(t, `$.id: expected "1", actual "2"`, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?id=2").Expect(ht.ExpectJsonEqualsFileExcept(golden, "$.items[*].at")).Test()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?id=2").Expect(ht.ExpectJsonEqualsFileExcept(golden, "$.id", "$.items[0].at")).Test()
+	})
+}
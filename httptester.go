@@ -2,17 +2,30 @@ package httptester
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ghodss/yaml"
 	"github.com/vaeryn-uk/frostember-server/pkg/fbrmath"
 	"io"
+	"io/fs"
+	"math"
+	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"regexp"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // TestingTB is a subset of testing.TB. This is here to allow
@@ -41,22 +54,51 @@ type HttpTester struct {
 	client        *http.Client
 	requests      []*HttpTesterRequest
 	multipartForm *multipart.Writer
+	verbose       bool
+	summary       bool
+	cookieJar     bool
+	jsonSchemaFS  fs.FS
+	captures      map[string]string
+	always        []ResponseOption
 }
 
-// New creates a new HttpTester wrapping t and using srv.
+// TesterOption is used to configure an HttpTester in New.
+type TesterOption func(tester *HttpTester)
+
+// New creates a new HttpTester wrapping t and using srv, configured by options.
 // Common usage:
 //
 //	ht := NewHttpTester(t, srv)
 //	ht.Request("GET", "/api/test", ht.SomeOption(), ...).Expect(ht.SomeExpectation(), ...).Test()
-func New(t TestingTB, srv *httptest.Server) *HttpTester {
+func New(t TestingTB, srv *httptest.Server, options ...TesterOption) *HttpTester {
 	tester := &HttpTester{
 		t:        t,
 		srv:      srv,
 		client:   srv.Client(),
 		requests: make([]*HttpTesterRequest, 0),
+		captures: make(map[string]string),
+	}
+
+	for _, opt := range options {
+		opt(tester)
+	}
+
+	// Installed once all options have run, so that it is kept on any client
+	// given by WithClient.
+	if tester.cookieJar && tester.client.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		must(t, err)
+
+		client := *tester.client
+		client.Jar = jar
+		tester.client = &client
 	}
 
 	t.Cleanup(func() {
+		if tester.summary {
+			tester.logSummary()
+		}
+
 		for _, req := range tester.requests {
 			if !req.done {
 				fatal(t, fmt.Sprintf("forgot to execute Test on test request at:\n%s\n", string(req.stack)))
@@ -67,6 +109,99 @@ func New(t TestingTB, srv *httptest.Server) *HttpTester {
 	return tester
 }
 
+// WithClient configures an HttpTester to send requests with client rather than
+// the server's default client, e.g. to customise its transport or redirect
+// policy. If client is nil, the server's default client is used.
+func WithClient(client *http.Client) TesterOption {
+	return func(tester *HttpTester) {
+		c := client
+		if c == nil {
+			c = tester.srv.Client()
+		}
+
+		tester.client = c
+	}
+}
+
+// WithCookieJar configures an HttpTester to keep cookies set by responses and
+// send them with subsequent requests, as a browser would. This makes it easy
+// to test session flows, e.g. logging in and then performing an action. The
+// cookie jar is only used by this HttpTester. If the tester's client already
+// has a jar, e.g. one given by WithClient, that is used instead.
+func WithCookieJar() TesterOption {
+	return func(tester *HttpTester) {
+		tester.cookieJar = true
+	}
+}
+
+// WithSummary configures an HttpTester to log a summary of its requests when
+// the test finishes: how many were tested, and which of those failed.
+func WithSummary() TesterOption {
+	return func(tester *HttpTester) {
+		tester.summary = true
+	}
+}
+
+// logSummary logs the outcome of all requests made with this tester.
+func (h *HttpTester) logSummary() {
+	passed, failed := 0, make([]string, 0)
+
+	for _, req := range h.requests {
+		if req.passed {
+			passed++
+		} else if req.done {
+			failed = append(failed, fmt.Sprintf("%s %s", req.request.Method, req.request.URL.RequestURI()))
+		}
+	}
+
+	summary := fmt.Sprintf("httptester: %d requests tested, %d passed, %d failed", passed+len(failed), passed, len(failed))
+	if len(failed) > 0 {
+		summary += "\nfailed:\n" + strings.Join(failed, "\n")
+	}
+
+	h.t.Log(summary)
+}
+
+// Verbose configures whether each successful Test logs a one-line summary of
+// the request, e.g. "GET /users/1 -> 200 (34ms)". This is off by default.
+func (h *HttpTester) Verbose(verbose bool) {
+	h.verbose = verbose
+}
+
+// Captures returns all values captured by requests tested so far with this
+// HttpTester. Where a capture name is reused, the latest value is returned.
+func (h *HttpTester) Captures() map[string]string {
+	captures := make(map[string]string, len(h.captures))
+	for name, val := range h.captures {
+		captures[name] = val
+	}
+
+	return captures
+}
+
+// AlwaysExpect configures this HttpTester to apply opts to every request's
+// expectations, in addition to those given to Expect. These are checked first
+// on every Test.
+func (h *HttpTester) AlwaysExpect(opts ...ResponseOption) {
+	h.always = append(h.always, opts...)
+}
+
+// FailOnServerError configures this HttpTester to fail any Test which receives
+// a 5xx response, regardless of the request's other expectations. This is a
+// safety net against unexpected server errors in tests focusing on something
+// else. See AlwaysExpect.
+func (h *HttpTester) FailOnServerError() {
+	h.AlwaysExpect(func(expectation *HttpExpectation) {
+		expectation.addHeaderExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if response.StatusCode >= 500 && response.StatusCode <= 599 {
+				fatal(t, "server error", append([]any{"status", response.Status}, extra...)...)
+			}
+		})
+	})
+}
+
 // RequestOption is used to configure an HttpTesterRequest.
 type RequestOption func(req *HttpTesterRequest)
 
@@ -91,11 +226,43 @@ func (h *HttpTester) Request(method, path string, options ...RequestOption) *Htt
 	return request
 }
 
+// Get is shorthand for Request with method GET.
+func (h *HttpTester) Get(path string, options ...RequestOption) *HttpTesterRequest {
+	return h.Request(http.MethodGet, path, options...)
+}
+
+// Post is shorthand for Request with method POST.
+func (h *HttpTester) Post(path string, options ...RequestOption) *HttpTesterRequest {
+	return h.Request(http.MethodPost, path, options...)
+}
+
+// Put is shorthand for Request with method PUT.
+func (h *HttpTester) Put(path string, options ...RequestOption) *HttpTesterRequest {
+	return h.Request(http.MethodPut, path, options...)
+}
+
+// Patch is shorthand for Request with method PATCH.
+func (h *HttpTester) Patch(path string, options ...RequestOption) *HttpTesterRequest {
+	return h.Request(http.MethodPatch, path, options...)
+}
+
+// Delete is shorthand for Request with method DELETE.
+func (h *HttpTester) Delete(path string, options ...RequestOption) *HttpTesterRequest {
+	return h.Request(http.MethodDelete, path, options...)
+}
+
 // Bearer configures a HttpTesterRequest with an bearer authorization token.
 func (h *HttpTester) Bearer(token string) RequestOption {
 	return h.Header("Authorization", fmt.Sprintf("Bearer %s", token))
 }
 
+// BasicAuth configures a HttpTesterRequest with HTTP Basic authentication.
+func (h *HttpTester) BasicAuth(username, password string) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.request.SetBasicAuth(username, password)
+	}
+}
+
 // Header configures a HttpTesterRequest to have a have with the given name, set to the
 // given val. E.g.:
 //
@@ -106,39 +273,211 @@ func (h *HttpTester) Header(name, val string) RequestOption {
 	}
 }
 
+// RemoveHeader configures a HttpTesterRequest to not send the header with the
+// given name, removing it if set by a preceding option. E.g. to test how a
+// server defaults a missing Content-Type:
+//
+//	ht.Request("POST", "/items", ht.JsonBody(item), ht.RemoveHeader("Content-Type"))
+func (h *HttpTester) RemoveHeader(name string) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.request.Header.Del(name)
+	}
+}
+
+// pathParamPlaceholder matches a {name} placeholder in a request path.
+var pathParamPlaceholder = regexp.MustCompile(`\{[^{}/]+\}`)
+
+// PathParams configures a HttpTesterRequest by replacing {name} placeholders in
+// its path with the URL-escaped values of params. Fails if any placeholders are
+// left unresolved once the request is complete. E.g.:
+//
+//	ht.Request("GET", "/users/{id}", ht.PathParams(map[string]string{"id": captures["id"]}))
+func (h *HttpTester) PathParams(params map[string]string) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.pathParams = true
+
+		u := req.request.URL
+		path, escaped := u.Path, u.EscapedPath()
+
+		for name, val := range params {
+			path = strings.ReplaceAll(path, "{"+name+"}", val)
+			escaped = strings.ReplaceAll(escaped, url.PathEscape("{"+name+"}"), url.PathEscape(val))
+		}
+
+		u.Path, u.RawPath = path, escaped
+	}
+}
+
+// Cookie configures a HttpTesterRequest to send cookie c. May be given
+// multiple times to send multiple cookies.
+func (h *HttpTester) Cookie(c *http.Cookie) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.request.AddCookie(c)
+	}
+}
+
+// CookieKV is like Cookie, for a cookie with the given name and value.
+func (h *HttpTester) CookieKV(name, value string) RequestOption {
+	return h.Cookie(&http.Cookie{Name: name, Value: value})
+}
+
+// Accept configures a HttpTesterRequest to accept the given media types in its
+// response, e.g. "application/json" or "application/xml;q=0.9, */*;q=0.1".
+func (h *HttpTester) Accept(mediaTypes string) RequestOption {
+	return h.Header("Accept", mediaTypes)
+}
+
+// Close configures a HttpTesterRequest to ask the server to close the
+// connection after responding, via "Connection: close".
+func (h *HttpTester) Close() RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.request.Close = true
+	}
+}
+
+// TrustedProxyChain configures a HttpTesterRequest as if it had been forwarded
+// by a chain of proxies, where ips are the client followed by each proxy
+// except the last, which is the test client itself. The chain is sent in both
+// the X-Forwarded-For header and the Forwarded header (RFC 7239).
+//
+// This is useful for testing how handlers determine the client's IP, e.g. for
+// rate limiting or geolocation. Note that handlers must be configured to trust
+// these headers from the test client, as they would from a real proxy.
+func (h *HttpTester) TrustedProxyChain(ips ...string) RequestOption {
+	forwarded := make([]string, len(ips))
+	for i, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+			// IPv6 addresses must be bracketed and quoted.
+			ip = fmt.Sprintf(`"[%s]"`, ip)
+		}
+		forwarded[i] = "for=" + ip
+	}
+
+	return func(req *HttpTesterRequest) {
+		req.request.Header.Set("X-Forwarded-For", strings.Join(ips, ", "))
+		req.request.Header.Set("Forwarded", strings.Join(forwarded, ", "))
+	}
+}
+
+// Context configures a HttpTesterRequest to be sent with ctx, e.g. to carry
+// values to the transport or to cancel the request.
+func (h *HttpTester) Context(ctx context.Context) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.request = req.request.WithContext(ctx)
+	}
+}
+
+// Timeout configures a HttpTesterRequest to fail the test if a full response
+// is not received within d of it being sent. This stops a hung server from
+// blocking the test.
+func (h *HttpTester) Timeout(d time.Duration) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.timeout = d
+	}
+}
+
+// NoRedirect configures a HttpTesterRequest to not follow redirects, so that
+// expectations apply to the redirect response itself, e.g.:
+//
+//	ht.Request("GET", "/old", ht.NoRedirect()).Expect(ht.ExpectCode(301), ht.ExpectHeader("Location", "/new")).Test()
+func (h *HttpTester) NoRedirect() RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.noRedirect = true
+	}
+}
+
+// Delay configures a HttpTesterRequest to wait for d before it is sent when
+// tested. This helps to orchestrate the order in which concurrent requests
+// reach the server.
+func (h *HttpTester) Delay(d time.Duration) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.delay = d
+	}
+}
+
 // Body configures a HttpTesterRequest with some data. If body is an
 // io.Reader, will grab the string data from that. Will fail the test if
 // given something other than a string or reader.
 //
-// As a convenience, args will be applied to the body via fmt.Printf rules.
+// As a convenience, args will be applied to the body via fmt.Printf rules. If
+// there are no args, the body is sent as is.
 func (h *HttpTester) Body(body any, args ...any) RequestOption {
 	h.t.Helper()
 
 	bodyStr, isStr := h.stringifyReader(body)
 
-	bodyStr, isStr = body.(string)
-
 	if !isStr {
 		fatal(h.t, "Body() must be given a string or an io.Reader")
 	}
 
 	return func(req *HttpTesterRequest) {
-		req.request.Body = io.NopCloser(strings.NewReader(fmt.Sprintf(bodyStr, args...)))
+		req.setBody("Body()", strings.NewReader(formatBody(bodyStr, args...)))
+	}
+}
+
+// RawBody configures a HttpTesterRequest to send data verbatim as its body. No
+// Content-Type is set, so use Header to specify one if needed.
+func (h *HttpTester) RawBody(data []byte) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.setBody("RawBody()", bytes.NewReader(data))
 	}
 }
 
+// StringBody is like RawBody, but for a string. Unlike Body, s is not treated
+// as a format string, so may safely contain "%".
+func (h *HttpTester) StringBody(s string) RequestOption {
+	return h.RawBody([]byte(s))
+}
+
 // JsonBody configures a HttpTesterRequest with a JSON body. If body is an
 // io.Reader, will grab the string data from that. If it is any other non-string
 // body, we json.Unmarshal it to get a string.
 //
 // As a convenience, args will be applied to the JSONified data via fmt.Printf rules
-// after the JSON is generated.
+// after the JSON is generated. If there are no args, the JSON is sent as is, so may
+// safely contain "%".
 func (h *HttpTester) JsonBody(body any, args ...any) RequestOption {
 	h.t.Helper()
 
-	bodyStr, isStr := h.stringifyReader(body)
+	return h.jsonBody("JsonBody()", "application/json", body, args...)
+}
+
+// MalformedJsonBody configures a HttpTesterRequest to send raw as its body
+// verbatim, with a JSON content type. This is intended for testing how
+// handlers deal with invalid JSON, e.g.:
+//
+//	ht.Request("POST", "/users", ht.MalformedJsonBody(`{"name": `)).Expect(ht.ExpectCode(400)).Test()
+func (h *HttpTester) MalformedJsonBody(raw string) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.request.Header.Set("Content-Type", "application/json")
+		req.setBody("MalformedJsonBody()", strings.NewReader(raw))
+	}
+}
+
+// JsonMergePatchBody is like JsonBody, but sets the content type for a JSON
+// Merge Patch (RFC 7396), "application/merge-patch+json".
+func (h *HttpTester) JsonMergePatchBody(body any, args ...any) RequestOption {
+	h.t.Helper()
+
+	return h.jsonBody("JsonMergePatchBody()", "application/merge-patch+json", body, args...)
+}
+
+// JsonPatchBody is like JsonBody, but sends a list of JSON Patch (RFC 6902)
+// operations with the content type "application/json-patch+json". E.g.:
+//
+//	ht.JsonPatchBody([]any{map[string]any{"op": "replace", "path": "/name", "value": "Scotty"}})
+func (h *HttpTester) JsonPatchBody(ops []any, args ...any) RequestOption {
+	h.t.Helper()
+
+	return h.jsonBody("JsonPatchBody()", "application/json-patch+json", ops, args...)
+}
 
-	bodyStr, isStr = body.(string)
+// jsonBody implements JsonBody and its variants, setting contentType on the
+// request. option names the variant for failure messages.
+func (h *HttpTester) jsonBody(option, contentType string, body any, args ...any) RequestOption {
+	h.t.Helper()
+
+	bodyStr, isStr := h.stringifyReader(body)
 
 	if !isStr {
 		b, err := json.MarshalIndent(body, "", "  ")
@@ -147,17 +486,26 @@ func (h *HttpTester) JsonBody(body any, args ...any) RequestOption {
 	}
 
 	return func(req *HttpTesterRequest) {
-		req.request.Header.Set("Content-Type", "application/json")
-		req.request.Body = io.NopCloser(strings.NewReader(fmt.Sprintf(bodyStr, args...)))
+		req.request.Header.Set("Content-Type", contentType)
+		req.setBody(option, strings.NewReader(formatBody(bodyStr, args...)))
 	}
 }
 
+// formatBody applies args to body via fmt.Sprintf, if there are any.
+func formatBody(body string, args ...any) string {
+	if len(args) == 0 {
+		return body
+	}
+
+	return fmt.Sprintf(body, args...)
+}
+
 // YamlBody configures a HttpTesterRequest with a YAML body. If body is an
 // io.Reader, will grab the string data from that. If it is any other non-string
 // body, we yaml.Unmarshal it to get a string.
 //
 // As a convenience, args will be applied to the YAMLified data via fmt.Printf rules
-// after the YAML is generated.
+// after the YAML is generated. If there are no args, the YAML is sent as is.
 //
 // "application/x-yaml" is set as the request content type.
 func (h *HttpTester) YamlBody(body any, args ...any) RequestOption {
@@ -165,8 +513,6 @@ func (h *HttpTester) YamlBody(body any, args ...any) RequestOption {
 
 	bodyStr, isStr := h.stringifyReader(body)
 
-	bodyStr, isStr = body.(string)
-
 	if !isStr {
 		b, err := yaml.Marshal(body)
 		must(h.t, err, "cannot convert body data to YAML", body)
@@ -175,10 +521,47 @@ func (h *HttpTester) YamlBody(body any, args ...any) RequestOption {
 
 	return func(req *HttpTesterRequest) {
 		req.request.Header.Set("Content-Type", "application/x-yaml")
-		req.request.Body = io.NopCloser(strings.NewReader(fmt.Sprintf(bodyStr, args...)))
+		req.setBody("YamlBody()", strings.NewReader(formatBody(bodyStr, args...)))
+	}
+}
+
+// RawBodyFromCapture configures a HttpTesterRequest to send a value captured by
+// an earlier request on this HttpTester verbatim as its body, with the given
+// content type. Combined with CaptureBody, this allows for round-trip tests
+// where one endpoint's output is fed into another. E.g.:
+//
+//	ht.Request("GET", "/export").Expect(ht.CaptureBody("export")).Test()
+//	ht.Request("POST", "/import", ht.RawBodyFromCapture("application/json", "export")).Expect(...).Test()
+func (h *HttpTester) RawBodyFromCapture(contentType, captureName string) RequestOption {
+	return func(req *HttpTesterRequest) {
+		h.t.Helper()
+
+		val, exists := h.captures[captureName]
+		if !exists {
+			fatal(h.t, "no value has been captured with this name", captureName)
+			return
+		}
+
+		req.request.Header.Set("Content-Type", contentType)
+		req.setBody("RawBodyFromCapture()", strings.NewReader(val))
+	}
+}
+
+// FormBody configures a HttpTesterRequest with a URL-encoded form body, as
+// submitted by HTML forms, e.g.:
+//
+//	ht.Request("POST", "/login", ht.FormBody(url.Values{"user": {"bob"}}))
+//
+// This cannot be combined with MultipartFormFile or MultipartFormField.
+func (h *HttpTester) FormBody(values url.Values) RequestOption {
+	return func(req *HttpTesterRequest) {
+		req.request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.setBody("FormBody()", strings.NewReader(values.Encode()))
 	}
 }
 
+// MultipartFormFile configures a HttpTesterRequest with a file in a multipart
+// form. This cannot be combined with options which set a body, e.g. JsonBody.
 func (h *HttpTester) MultipartFormFile(fieldname, filename string, data io.Reader) RequestOption {
 	return func(req *HttpTesterRequest) {
 		file, err := req.multipart().CreateFormFile(fieldname, filename)
@@ -189,6 +572,8 @@ func (h *HttpTester) MultipartFormFile(fieldname, filename string, data io.Reade
 	}
 }
 
+// MultipartFormField configures a HttpTesterRequest with a field in a multipart
+// form. This cannot be combined with options which set a body, e.g. JsonBody.
 func (h *HttpTester) MultipartFormField(name string, val []byte) RequestOption {
 	return func(req *HttpTesterRequest) {
 		field, err := req.multipart().CreateFormField(name)
@@ -199,144 +584,1844 @@ func (h *HttpTester) MultipartFormField(name string, val []byte) RequestOption {
 	}
 }
 
+// MultipartForm configures a HttpTesterRequest with a multipart form containing
+// all of fields and files, as per MultipartFormField and MultipartFormFile. Each
+// file is named after its field. Fields are written in sorted order, followed
+// by files in sorted order, so that requests are stable, e.g.:
+//
+//	ht.MultipartForm(map[string]string{"title": "Report"}, map[string]io.Reader{"report.pdf": file})
+func (h *HttpTester) MultipartForm(fields map[string]string, files map[string]io.Reader) RequestOption {
+	return func(req *HttpTesterRequest) {
+		for _, name := range sortedKeys(fields) {
+			h.MultipartFormField(name, []byte(fields[name]))(req)
+		}
+
+		for _, name := range sortedKeys(files) {
+			h.MultipartFormFile(name, name, files[name])(req)
+		}
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
 // ExpectCode configures an HttpExpectation to require a certain response code.
 func (h *HttpTester) ExpectCode(code int) ResponseOption {
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
-			h.t.Helper()
-			equals(h.t, code, response.StatusCode, extra...)
+		expectation.addHeaderExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+			equals(t, code, response.StatusCode, extra...)
+		})
+	}
+}
+
+// ExpectCodeInRange configures an HttpExpectation to require a response code
+// between min and max inclusive.
+func (h *HttpTester) ExpectCodeInRange(min, max int) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addHeaderExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if response.StatusCode < min || response.StatusCode > max {
+				args := []any{"expected", fmt.Sprintf("%d-%d", min, max), "actual", response.Status}
+				args = append(args, extra...)
+				fatal(t, "response code is out of range", args...)
+			}
 		})
 	}
 }
 
+// ExpectSuccess configures an HttpExpectation to require a 2xx response code.
+func (h *HttpTester) ExpectSuccess() ResponseOption {
+	return h.ExpectCodeInRange(200, 299)
+}
+
+// ExpectClientError configures an HttpExpectation to require a 4xx response
+// code.
+func (h *HttpTester) ExpectClientError() ResponseOption {
+	return h.ExpectCodeInRange(400, 499)
+}
+
+// ExpectServerError configures an HttpExpectation to require a 5xx response
+// code.
+func (h *HttpTester) ExpectServerError() ResponseOption {
+	return h.ExpectCodeInRange(500, 599)
+}
+
 // ExpectBodyContains configure an HttpExpectation to require the response body
 // contains the content string at least once.
 func (h *HttpTester) ExpectBodyContains(content string) ResponseOption {
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
 			if strings.Index(body, content) < 0 {
 				args := []any{"contains", content, "body", body}
 				args = append(args, extra...)
-				fatal(h.t, "body contains failed", args...)
+				fatal(t, "body contains failed", args...)
 			}
 		})
 	}
 }
 
-func (h *HttpTester) ExpectContentType(contentType string) ResponseOption {
+// ExpectEmptyBody configures an HttpExpectation to require the response has no
+// body, e.g. for 204 No Content responses.
+func (h *HttpTester) ExpectEmptyBody() ResponseOption {
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
-			equals(h.t, contentType, response.Header.Get("Content-Type"), extra...)
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if len(body) > 0 {
+				args := []any{"body", body}
+				args = append(args, extra...)
+				fatal(t, "response body is not empty", args...)
+			}
 		})
 	}
 }
 
-func (h *HttpTester) ExpectJsonNotExists(path string) ResponseOption {
+// ExpectBodyMatches configures an HttpExpectation to require the response body
+// matches the regular expression pattern.
+func (h *HttpTester) ExpectBodyMatches(pattern string) ResponseOption {
 	h.t.Helper()
 
+	re, err := regexp.Compile(pattern)
+	must(h.t, err, "invalid pattern", pattern)
+
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
-			h.t.Helper()
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
 
-			JsonNotContains(h.t, body, path, extra...)
+			if !re.MatchString(body) {
+				args := []any{"pattern", pattern, "body", body}
+				args = append(args, extra...)
+				fatal(t, "body does not match pattern", args...)
+			}
 		})
 	}
 }
 
-// ExpectJsonExists configures an HttpExpectation to require a JSON body which contains
-// a non-empty string value at jsonpath path.
-func (h *HttpTester) ExpectJsonExists(path string) ResponseOption {
+// ExpectBodyNotMatches is the inverse of ExpectBodyMatches.
+func (h *HttpTester) ExpectBodyNotMatches(pattern string) ResponseOption {
 	h.t.Helper()
 
+	re, err := regexp.Compile(pattern)
+	must(h.t, err, "invalid pattern", pattern)
+
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
-			h.t.Helper()
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
 
-			JsonContainsStr(h.t, body, path, extra...)
+			if re.MatchString(body) {
+				args := []any{"pattern", pattern, "match", re.FindString(body), "body", body}
+				args = append(args, extra...)
+				fatal(t, "body unexpectedly matches pattern", args...)
+			}
 		})
 	}
 }
 
-// ExpectJsonMatchStr extends ExpectJsonExists to also ensure that the value found at jsonpath
-// path matches the expected string match.
-func (h *HttpTester) ExpectJsonMatchStr(path, match string) ResponseOption {
+func (h *HttpTester) ExpectContentType(contentType string) ResponseOption {
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
-			h.t.Helper()
-
-			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
-			equals(h.t, match, JsonContainsStr(h.t, body, path, extra...), extra...)
+		expectation.addHeaderExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			equals(t, contentType, response.Header.Get("Content-Type"), extra...)
 		})
 	}
 }
 
-// ExpectJsonMatch asserts that the HTTP response has a JSON body which contains a value
-// at JSON path which matches parameter match.
-//
-// Note that numbers in the JSON will be float64 in Go.
-func (h *HttpTester) ExpectJsonMatch(path string, match any) ResponseOption {
+// ExpectCreated asserts the common contract of a response creating a resource:
+// a 201 Created status, a Location header if locationPresent, and a JSON body
+// containing a non-empty ID at JSON path idPath.
+func (h *HttpTester) ExpectCreated(locationPresent bool, idPath string) ResponseOption {
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
-			h.t.Helper()
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
 
-			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
-			equals(h.t, match, JsonContains(h.t, body, path, extra...), extra...)
+			if response.StatusCode != http.StatusCreated {
+				fatal(t, "expected 201 Created", append([]any{"actual", response.Status}, extra...)...)
+				return
+			}
+
+			if locationPresent && response.Header.Get("Location") == "" {
+				fatal(t, "expected a Location header for the created resource", extra...)
+				return
+			}
+
+			id := JsonContains(t, body, idPath, append([]any{fmt.Sprintf("json path: %s", idPath)}, extra...)...)
+			if id == nil || id == "" {
+				args := []any{"json path", idPath, "value", id}
+				args = append(args, extra...)
+				fatal(t, "expected a non-empty ID for the created resource", args...)
+			}
 		})
 	}
 }
 
-// ExpectYamlMatch asserts that the HTTP response has a YAML body which contains a value
-// at JSON path which matches the parameter match.
-//
-// This convert YAML to JSON, then performs matching as per JSONPath.
-//
-// This makes no assertions on the response's content type, but will fail the test if
-// the content cannot be parsed as YAML.
-//
-// Note that numbers in the JSON will be float64 in Go.
-func (h *HttpTester) ExpectYamlMatch(path string, match any) ResponseOption {
+// ExpectAuthChallenge asserts that the response is a 401 Unauthorized with a
+// WWW-Authenticate header challenging the client to authenticate with scheme,
+// e.g. "Bearer" or "Basic".
+func (h *HttpTester) ExpectAuthChallenge(scheme string) ResponseOption {
+	return h.ExpectAuthChallengeRealm(scheme, "")
+}
+
+// ExpectAuthChallengeRealm is like ExpectAuthChallenge, but also requires the
+// challenge to specify realm. If realm is empty, it is not checked.
+func (h *HttpTester) ExpectAuthChallengeRealm(scheme, realm string) ResponseOption {
 	return func(expectation *HttpExpectation) {
-		expectation.addExpectation(func(response *http.Response, body string, extra ...any) {
-			h.t.Helper()
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
 
-			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+			equals(t, http.StatusUnauthorized, response.StatusCode, extra...)
 
-			var parsedData any
-			err := yaml.Unmarshal([]byte(body), &parsedData)
-			must(h.t, err, append([]any{"failed to decode response body as YAML"}, extra...))
+			challenges := response.Header.Values("WWW-Authenticate")
+
+			for _, challenge := range challenges {
+				challengeScheme, params, _ := strings.Cut(challenge, " ")
+				if !strings.EqualFold(challengeScheme, scheme) {
+					continue
+				}
 
-			equals(h.t, match, DataContains(h.t, parsedData, path, extra...), extra...)
+				if realm == "" || strings.Contains(params, fmt.Sprintf("realm=%q", realm)) {
+					return
+				}
+			}
+
+			args := []any{"scheme", scheme, "realm", realm, "WWW-Authenticate", challenges}
+			args = append(args, extra...)
+			fatal(t, "response does not have the expected authentication challenge", args...)
 		})
 	}
 }
 
-// CaptureJson defines a capture against the response's JSON body. If
-// successful, this capture is available under name from HttpExpectation.Test.
-// Will fatal if there are no string value to capture, so this implies ExpectJsonExists.
-func (h *HttpTester) CaptureJson(name, jsonpath string) ResponseOption {
+// ExpectMediaType configures an HttpExpectation to require the response's
+// Content-Type is of the given media type. Unlike ExpectContentType, parameters
+// such as charset are ignored.
+func (h *HttpTester) ExpectMediaType(mediaType string) ResponseOption {
 	return func(expectation *HttpExpectation) {
-		h.t.Helper()
+		expectation.addHeaderExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			contentType := response.Header.Get("Content-Type")
 
-		expectation.jsonCaptures[name] = jsonpath
+			actual, _, err := mime.ParseMediaType(contentType)
+			if err != nil || !strings.EqualFold(actual, mediaType) {
+				args := []any{"expected", mediaType, "Content-Type", contentType}
+				args = append(args, extra...)
+				fatal(t, "response is not of the expected media type", args...)
+			}
+		})
 	}
 }
 
-// HttpTesterRequest defines a request we're going to test against.
-type HttpTesterRequest struct {
-	request             *http.Request
-	tester              *HttpTester
-	done                bool
-	stack               []byte
-	multipartForm       *multipart.Writer
-	multipartFormBuffer *bytes.Buffer
-}
+// ExpectNegotiated tests content negotiation. It sends the request with the
+// given Accept header, then requires the response to be of
+// expectedContentType, as per ExpectMediaType. opts are applied to the response
+// as normal. This makes it easy to test a matrix of Accept headers, e.g.:
+//
+//	for accept, contentType := range map[string]string{"application/json": "application/json", "text/*": "text/csv"} {
+//		ht.Request("GET", "/report").Expect(ht.ExpectNegotiated(accept, contentType, ht.ExpectCode(200))).Test()
+//	}
+func (h *HttpTester) ExpectNegotiated(accept, expectedContentType string, opts ...ResponseOption) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		h.Accept(accept)(expectation.request)
+		h.ExpectMediaType(expectedContentType)(expectation)
 
-// Expect returns a configured HttpExpectation to test against.
-func (h *HttpTesterRequest) Expect(options ...ResponseOption) *HttpExpectation {
-	expectation := &HttpExpectation{
-		request:              h,
-		responseExpectations: make([]responseExpectation, 0),
-		jsonCaptures:         make(map[string]string),
+		for _, opt := range opts {
+			opt(expectation)
+		}
+	}
+}
+
+// ExpectDefaultContentType tests the server's fallback when content is not
+// negotiated. The request is sent without an Accept header, even if one was
+// configured, and the response must be of contentType, as per ExpectMediaType.
+func (h *HttpTester) ExpectDefaultContentType(contentType string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.request.request.Header.Del("Accept")
+		h.ExpectMediaType(contentType)(expectation)
+	}
+}
+
+// ExpectPerVersion tests a versioned API. For each case, the request is sent
+// again with header headerName set to the case's version, and that response
+// must meet the case's expectations. Failures report the version. E.g.:
+//
+//	ht.Request("GET", "/users/1").Expect(ht.ExpectPerVersion("API-Version", map[string][]httptester.ResponseOption{
+//		"1": {ht.ExpectJsonExists("$.name")},
+//		"2": {ht.ExpectJsonExists("$.fullName"), ht.ExpectJsonNotExists("$.name")},
+//	})).Test()
+func (h *HttpTester) ExpectPerVersion(headerName string, cases map[string][]ResponseOption) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			versions := make([]string, 0, len(cases))
+			for version := range cases {
+				versions = append(versions, version)
+			}
+			sort.Strings(versions)
+
+			for _, version := range versions {
+				versioned := expectation.request.Expect(cases[version]...)
+
+				r := expectation.request.build()
+				r.Header.Set(headerName, version)
+
+				versionExtra := append([]any{"version", fmt.Sprintf("%s: %s", headerName, version)}, extra...)
+
+				versionedResponse, versionedBody, _ := expectation.request.send(t, r, false, versioned.bodyWrappers, versionExtra...)
+
+				for _, versionedExpectation := range versioned.responseExpectations {
+					versionedExpectation(t, versionedResponse, versionedBody, versionExtra...)
+				}
+			}
+		})
+	}
+}
+
+// AcceptLanguage configures a HttpTesterRequest to accept responses in the
+// given languages, e.g. "fr-CH, fr;q=0.9, en;q=0.8". See ExpectContentLanguage.
+func (h *HttpTester) AcceptLanguage(langs string) RequestOption {
+	return h.Header("Accept-Language", langs)
+}
+
+// ExpectContentLanguage configures an HttpExpectation to require the response's
+// Content-Language is lang, e.g. "fr-CH". Language tags are compared
+// case-insensitively.
+func (h *HttpTester) ExpectContentLanguage(lang string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if actual := response.Header.Get("Content-Language"); !strings.EqualFold(actual, lang) {
+				args := []any{"expected", lang, "Content-Language", actual}
+				args = append(args, extra...)
+				fatal(t, "response is not in the expected language", args...)
+			}
+		})
+	}
+}
+
+var (
+	// ReceivedPathHeader is the response header in which handlers echo the path
+	// they received, for use with ExpectReceivedPath.
+	ReceivedPathHeader = "X-Received-Path"
+
+	// ReceivedMethodHeader is the response header in which handlers echo the
+	// method they received, for use with ExpectReceivedMethod.
+	ReceivedMethodHeader = "X-Received-Method"
+)
+
+// ExpectReceivedPath asserts that the handler received the request with the
+// given path. This is useful when testing middleware which rewrites requests,
+// but requires the handler to echo the path it received in the
+// ReceivedPathHeader response header, e.g.:
+//
+//	w.Header().Set(httptester.ReceivedPathHeader, r.URL.Path)
+func (h *HttpTester) ExpectReceivedPath(path string) ResponseOption {
+	return h.expectEchoed(ReceivedPathHeader, path)
+}
+
+// ExpectReceivedMethod is like ExpectReceivedPath, but asserts that the handler
+// received the given method, echoed in the ReceivedMethodHeader header.
+func (h *HttpTester) ExpectReceivedMethod(method string) ResponseOption {
+	return h.expectEchoed(ReceivedMethodHeader, method)
+}
+
+// expectEchoed requires the response header name to echo expected.
+func (h *HttpTester) expectEchoed(name, expected string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if actual := response.Header.Get(name); actual != expected {
+				args := []any{"header", name, "expected", expected, "actual", actual}
+				args = append(args, extra...)
+				fatal(t, "handler did not receive the expected request", args...)
+			}
+		})
+	}
+}
+
+// ExpectHeader configures an HttpExpectation to require that the response has
+// a header name with the value val. Where the header has multiple values, any
+// may match.
+func (h *HttpTester) ExpectHeader(name, val string) ResponseOption {
+	return h.expectHeaderValue(name, "response header does not have the expected value", func(actual string) bool {
+		return actual == val
+	}, "expected", val)
+}
+
+// ExpectRedirect configures an HttpExpectation to require a redirect response
+// with the given status code to location. The request will not follow
+// redirects, as per NoRedirect. E.g.:
+//
+//	ht.Request("GET", "/account").Expect(ht.ExpectRedirect(http.StatusFound, "/login")).Test()
+func (h *HttpTester) ExpectRedirect(code int, location string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.request.noRedirect = true
+
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if response.StatusCode != code {
+				args := []any{"expected", code, "actual", response.Status, "location", response.Header.Get("Location")}
+				args = append(args, extra...)
+				fatal(t, "response is not the expected redirect", args...)
+			}
+
+			if actual := response.Header.Get("Location"); actual != location {
+				args := []any{"expected", location, "actual", actual}
+				args = append(args, extra...)
+				fatal(t, "response redirects to the wrong location", args...)
+			}
+		})
+	}
+}
+
+// ExpectHeaderContains is like ExpectHeader, but only requires that a value of
+// header name contains substr, e.g. for Cache-Control directives.
+func (h *HttpTester) ExpectHeaderContains(name, substr string) ResponseOption {
+	return h.expectHeaderValue(name, "response header does not contain the expected value", func(actual string) bool {
+		return strings.Contains(actual, substr)
+	}, "expected to contain", substr)
+}
+
+// expectHeaderValue requires that a value of response header name satisfies
+// match, failing with msg, described by expected, otherwise.
+func (h *HttpTester) expectHeaderValue(name, msg string, match func(actual string) bool, expected ...any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addHeaderExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			values := response.Header.Values(name)
+			for _, val := range values {
+				if match(val) {
+					return
+				}
+			}
+
+			args := append([]any{"header", name}, expected...)
+			args = append(args, "actual", values)
+			args = append(args, extra...)
+			fatal(t, msg, args...)
+		})
+	}
+}
+
+// ExpectCookie asserts that the response sets a cookie called name to value.
+func (h *HttpTester) ExpectCookie(name, value string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			cookie := responseCookie(t, response, name, extra...)
+
+			if cookie.Value != value {
+				args := []any{"cookie", name, "expected", value, "actual", cookie.Value}
+				args = append(args, extra...)
+				fatal(t, "response cookie has an unexpected value", args...)
+			}
+		})
+	}
+}
+
+// ExpectCookieExists asserts that the response sets a cookie called name, with
+// any value.
+func (h *HttpTester) ExpectCookieExists(name string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			responseCookie(t, response, name, extra...)
+		})
+	}
+}
+
+// responseCookie fatals unless response sets a cookie called name, returning
+// it.
+func responseCookie(t TestingTB, response *http.Response, name string, extra ...any) *http.Cookie {
+	t.Helper()
+
+	names := make([]string, 0)
+
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+
+		names = append(names, cookie.Name)
+	}
+
+	args := []any{"cookie", name, "present", names}
+	args = append(args, extra...)
+	fatal(t, "response does not set cookie", args...)
+
+	return &http.Cookie{}
+}
+
+// ExpectAllow asserts that the response's Allow header lists exactly methods,
+// in any order, as is expected of responses to OPTIONS requests. Missing and
+// unexpected methods are reported.
+func (h *HttpTester) ExpectAllow(methods ...string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			allowed := make([]string, 0)
+			for _, val := range response.Header.Values("Allow") {
+				for _, method := range strings.Split(val, ",") {
+					if method = strings.TrimSpace(method); method != "" {
+						allowed = append(allowed, method)
+					}
+				}
+			}
+
+			missing, unexpected := make([]string, 0), make([]string, 0)
+
+			for _, method := range methods {
+				if !contains(allowed, method) {
+					missing = append(missing, method)
+				}
+			}
+
+			for _, method := range allowed {
+				if !contains(methods, method) {
+					unexpected = append(unexpected, method)
+				}
+			}
+
+			if len(missing) > 0 || len(unexpected) > 0 {
+				args := []any{"missing", missing, "unexpected", unexpected, "Allow", response.Header.Values("Allow")}
+				args = append(args, extra...)
+				fatal(t, "response does not allow exactly the expected methods", args...)
+			}
+		})
+	}
+}
+
+// ExpectSingleHeader configures an HttpExpectation to require that the response
+// header name is sent exactly once. This catches middleware which duplicates
+// headers such as Content-Type.
+func (h *HttpTester) ExpectSingleHeader(name string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addHeaderExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			values := response.Header.Values(name)
+			if len(values) != 1 {
+				args := []any{"header", name, "count", len(values), "values", values}
+				args = append(args, extra...)
+				fatal(t, "expected header exactly once", args...)
+			}
+		})
+	}
+}
+
+// ExpectConnectionClosed asserts that the server signalled it would close the
+// connection after the response, i.e. it sent "Connection: close".
+//
+// Note that Go's HTTP server, as used by httptest, will always reply with this
+// if the request asked to close the connection, so a request configured with
+// Close will pass regardless of the handler's behaviour.
+func (h *HttpTester) ExpectConnectionClosed() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if !response.Close && !strings.EqualFold(response.Header.Get("Connection"), "close") {
+				args := []any{"Connection header", response.Header.Values("Connection")}
+				args = append(args, extra...)
+				fatal(t, "expected the server to close the connection", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonNotExists configures an HttpExpectation to require a JSON body in
+// which jsonpath path does not match anything, as per JsonNotContains. E.g. to
+// ensure that sensitive fields are not exposed:
+//
+//	ht.ExpectJsonNotExists("$..password")
+func (h *HttpTester) ExpectJsonNotExists(path string) ResponseOption {
+	h.t.Helper()
+
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			JsonNotContains(t, body, path, extra...)
+		})
+	}
+}
+
+// ExpectJsonExists configures an HttpExpectation to require a JSON body which contains
+// a non-empty string value at jsonpath path.
+func (h *HttpTester) ExpectJsonExists(path string) ResponseOption {
+	h.t.Helper()
+
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			JsonContainsStr(t, body, path, extra...)
+		})
+	}
+}
+
+// ExpectJsonExistsAll asserts that the HTTP response has a JSON body with a
+// non-empty value at each of paths. Unlike ExpectJsonExists, values need not be
+// strings, but null and empty strings are considered missing. All missing
+// paths are reported together.
+func (h *HttpTester) ExpectJsonExistsAll(paths ...string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			data := MustParseJson[any](t, strings.NewReader(body), extra...)
+
+			missing := make([]string, 0)
+
+			for _, path := range paths {
+				actual, err := lookupJsonPath(data, path)
+				if err != nil {
+					missing = append(missing, fmt.Sprintf("%s: %s", path, err))
+				} else if actual == nil || actual == "" {
+					missing = append(missing, fmt.Sprintf("%s: value is empty", path))
+				}
+			}
+
+			if len(missing) > 0 {
+				args := []any{strings.Join(missing, "\n")}
+				args = append(args, extra...)
+				fatal(t, "JSON paths are missing", args...)
+			}
+		})
+	}
+}
+
+// RedactionMarkers are the values ExpectRedacted accepts in place of redacted
+// data.
+var RedactionMarkers = []string{"***", ""}
+
+// ExpectRedacted asserts that the HTTP response has a JSON body which does not
+// reveal sensitive data at any of paths, e.g. $.ssn or $.cards[*].number. Each
+// must be absent, null or one of RedactionMarkers. All leaking paths are
+// reported together, though their values are not.
+func (h *HttpTester) ExpectRedacted(paths ...string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			data := MustParseJson[any](t, strings.NewReader(body), extra...)
+
+			leaked := make([]string, 0)
+
+			for _, path := range paths {
+				actual, err := lookupJsonPath(data, path)
+				if err != nil || actual == nil {
+					continue
+				}
+
+				// Paths matching many values resolve to a list of them.
+				values, isList := actual.([]any)
+				if !isList || !(strings.ContainsAny(path, "*?") || strings.Contains(path, "..")) {
+					values = []any{actual}
+				}
+
+				for _, val := range values {
+					if str, isStr := val.(string); val != nil && (!isStr || !contains(RedactionMarkers, str)) {
+						leaked = append(leaked, path)
+						break
+					}
+				}
+			}
+
+			if len(leaked) > 0 {
+				args := []any{"paths", leaked}
+				args = append(args, extra...)
+				fatal(t, "response contains unredacted values", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonMatchStr extends ExpectJsonExists to also ensure that the value found at jsonpath
+// path matches the expected string match.
+func (h *HttpTester) ExpectJsonMatchStr(path, match string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+			equals(t, match, JsonContainsStr(t, body, path, extra...), extra...)
+		})
+	}
+}
+
+// ExpectJsonNotMatch is the inverse of ExpectJsonMatch: a value must exist at
+// JSON path, but not match notExpected. Numbers are compared as per
+// ExpectJsonMatch.
+func (h *HttpTester) ExpectJsonNotMatch(path string, notExpected any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+
+			if reflect.DeepEqual(normaliseNumber(notExpected), normaliseNumber(JsonContains(t, body, path, extra...))) {
+				args := []any{"value", notExpected}
+				args = append(args, extra...)
+				fatal(t, "JSON value unexpectedly matches", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonMatchRegex extends ExpectJsonExists to also ensure that the string
+// value found at jsonpath path matches the regular expression pattern. This
+// suits values with a known shape but unpredictable content, e.g. UUIDs.
+func (h *HttpTester) ExpectJsonMatchRegex(path, pattern string) ResponseOption {
+	h.t.Helper()
+
+	re, err := regexp.Compile(pattern)
+	must(h.t, err, "invalid pattern", pattern)
+
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			value := JsonContainsStr(t, body, path, append([]any{fmt.Sprintf("json path: %s", path)}, extra...)...)
+
+			if !re.MatchString(value) {
+				args := []any{"json path", path, "value", value, "pattern", pattern}
+				args = append(args, extra...)
+				fatal(t, "JSON value does not match pattern", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonMatch asserts that the HTTP response has a JSON body which contains a value
+// at JSON path which matches parameter match.
+//
+// Note that numbers in the JSON will be float64 in Go, but match may be of any
+// numeric type, e.g. 3 matches 3.0.
+func (h *HttpTester) ExpectJsonMatch(path string, match any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+			equals(t, normaliseNumber(match), normaliseNumber(JsonContains(t, body, path, extra...)), extra...)
+		})
+	}
+}
+
+// ExpectJsonMatches is like ExpectJsonMatch, but checks many JSON paths at once.
+// Each key in pairs is a JSON path, with its value being the expected match.
+// All mismatches are reported together.
+func (h *HttpTester) ExpectJsonMatches(pairs map[string]any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			data := MustParseJson[any](t, strings.NewReader(body), extra...)
+
+			paths := make([]string, 0, len(pairs))
+			for path := range pairs {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+
+			failures := make([]string, 0)
+
+			for _, path := range paths {
+				actual, err := lookupJsonPath(data, path)
+				if err != nil {
+					failures = append(failures, fmt.Sprintf("%s: %s", path, err))
+				} else if !reflect.DeepEqual(normaliseNumber(pairs[path]), normaliseNumber(actual)) {
+					failures = append(failures, fmt.Sprintf("%s: expected %v, actual %v", path, pairs[path], actual))
+				}
+			}
+
+			if len(failures) > 0 {
+				args := []any{strings.Join(failures, "\n")}
+				args = append(args, extra...)
+				fatal(t, "JSON paths do not match", args...)
+			}
+		})
+	}
+}
+
+// ExpectLongPoll configures a request to a long-polling endpoint, which may hold
+// the connection open until it has something to respond with. The request is
+// given up to maxWait to respond, failing the test if it does not, after which
+// opts are applied to the response as normal. E.g.:
+//
+//	ht.Request("GET", "/notifications").Expect(ht.ExpectLongPoll(10*time.Second, ht.ExpectCode(200))).Test()
+func (h *HttpTester) ExpectLongPoll(maxWait time.Duration, opts ...ResponseOption) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.request.timeout = maxWait
+
+		for _, opt := range opts {
+			opt(expectation)
+		}
+	}
+}
+
+// ExpectReceivedBodyLength asserts that the handler received the full request
+// body. This relies on the handler (or a middleware wrapping it in tests)
+// reporting how many bytes of the body it read as a number in its JSON response
+// at path, e.g.:
+//
+//	n, _ := io.Copy(io.Discard, r.Body)
+//	json.NewEncoder(w).Encode(map[string]any{"received": n})
+//
+// This is then compared against the length of the body that was sent:
+//
+//	ht.Request("POST", "/upload", ht.Body(data)).Expect(ht.ExpectReceivedBodyLength("$.received")).Test()
+func (h *HttpTester) ExpectReceivedBodyLength(path string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+
+			received, isNum := JsonContains(t, body, path, extra...).(float64)
+			if !isNum {
+				fatal(t, "received body length is not a number", extra...)
+				return
+			}
+
+			sent := len(expectation.request.body)
+			if int(received) != sent {
+				args := []any{"sent", sent, "received", received}
+				args = append(args, extra...)
+				fatal(t, "handler did not receive the full request body", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonLen asserts that the HTTP response has a JSON body with an array
+// or object at JSON path, which has length elements or keys respectively.
+func (h *HttpTester) ExpectJsonLen(path string, length int) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			var actual int
+
+			switch val := JsonContains(t, body, path, extra...).(type) {
+			case []any:
+				actual = len(val)
+			case map[string]any:
+				actual = len(val)
+			default:
+				args := []any{"json path", path, "value", compactJson(val)}
+				args = append(args, extra...)
+				fatal(t, "value is not an array or object, so has no length", args...)
+				return
+			}
+
+			if actual != length {
+				args := []any{"json path", path, "expected", length, "actual", actual}
+				args = append(args, extra...)
+				fatal(t, "JSON value does not have the expected length", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonArrayElement asserts that the HTTP response has a JSON body with an
+// array at arrayPath which has an element at index. fn is then invoked with that
+// element for further assertions, e.g.:
+//
+//	ht.ExpectJsonArrayElement("$.items", 2, func(element any) {
+//		// Assert against element.
+//	})
+func (h *HttpTester) ExpectJsonArrayElement(arrayPath string, index int, fn func(element any)) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", arrayPath)}, extra...)
+
+			array, isArray := JsonContains(t, body, arrayPath, extra...).([]any)
+			if !isArray {
+				fatal(t, "json path does not resolve to an array", extra...)
+				return
+			}
+
+			if index < 0 || index >= len(array) {
+				args := []any{"index", index, "length", len(array)}
+				args = append(args, extra...)
+				fatal(t, "array index out of range", args...)
+				return
+			}
+
+			fn(array[index])
+		})
+	}
+}
+
+// ExpectJsonEqualsStruct asserts that the HTTP response has a JSON body which,
+// when decoded into a new value of the same type as expected, is equal to
+// expected. On failure, each differing struct field is reported by its Go name.
+//
+//	ht.ExpectJsonEqualsStruct(User{ID: 1, Name: "Scotty"})
+func (h *HttpTester) ExpectJsonEqualsStruct(expected any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if expected == nil {
+				fatal(t, "expected struct must not be nil", extra...)
+				return
+			}
+
+			actual := reflect.New(reflect.TypeOf(expected))
+			err := json.Unmarshal([]byte(body), actual.Interface())
+			must(t, err, append([]any{"failed to decode response body", "type", actual.Elem().Type()}, extra...)...)
+
+			name := actual.Elem().Type().Name()
+			if name == "" {
+				name = actual.Elem().Type().String()
+			}
+
+			diff := structDiff(name, reflect.ValueOf(expected), actual.Elem())
+			if len(diff) > 0 {
+				args := []any{strings.Join(diff, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response does not equal expected struct", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonEquals asserts that the HTTP response has a JSON body equal to
+// expected, once expected is itself converted to JSON. Object key order and
+// formatting are ignored, and as both are compared as decoded JSON, Go integers
+// and floats are equal to the same JSON number. Differences are reported per
+// path.
+func (h *HttpTester) ExpectJsonEquals(expected any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if diff := jsonEqualsDiff(t, expected, body, 0, extra...); len(diff) > 0 {
+				args := []any{"diff", strings.Join(diff, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response JSON does not equal expected", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonEqualsApprox is like ExpectJsonEquals, but numbers are considered
+// equal if they differ by no more than tolerance, making this suitable for
+// responses containing calculated values, e.g. coordinates or prices.
+func (h *HttpTester) ExpectJsonEqualsApprox(expected any, tolerance float64) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if diff := jsonEqualsDiff(t, expected, body, tolerance, extra...); len(diff) > 0 {
+				args := []any{"tolerance", tolerance, "diff", strings.Join(diff, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response JSON is not approximately equal", args...)
+			}
+		})
+	}
+}
+
+// jsonEqualsDiff converts expected to JSON and compares it to body, as per
+// jsonDiffWithin.
+func jsonEqualsDiff(t TestingTB, expected any, body string, tolerance float64, extra ...any) []string {
+	t.Helper()
+
+	expectedJson, err := json.Marshal(expected)
+	must(t, err, append([]any{"cannot convert expected data to JSON", expected}, extra...)...)
+
+	return jsonDiffWithin(
+		"$",
+		MustParseJson[any](t, bytes.NewReader(expectedJson), extra...),
+		MustParseJson[any](t, strings.NewReader(body), extra...),
+		tolerance,
+	)
+}
+
+// ExpectJsonShapeOf asserts that the HTTP response has a JSON body with the
+// shape of prototype, typically a struct used to build the response. Every
+// field that encoding/json would produce must be present with a compatible
+// JSON type, though values are not compared. Fields tagged omitempty may be
+// absent, and the response may contain additional fields.
+//
+//	ht.ExpectJsonShapeOf(UserResponse{})
+func (h *HttpTester) ExpectJsonShapeOf(prototype any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if prototype == nil {
+				fatal(t, "prototype must not be nil", extra...)
+				return
+			}
+
+			data := MustParseJson[any](t, strings.NewReader(body), extra...)
+
+			if diff := jsonShapeDiff("$", reflect.TypeOf(prototype), data); len(diff) > 0 {
+				args := []any{"type", reflect.TypeOf(prototype), "mismatches", strings.Join(diff, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response JSON does not have the expected shape", args...)
+			}
+		})
+	}
+}
+
+// ExpectCanonicalJson asserts that the HTTP response's body is JSON in
+// canonical form, i.e. with object keys sorted and no insignificant whitespace.
+// This is useful for APIs whose responses are signed, which requires that they
+// are serialized deterministically.
+func (h *HttpTester) ExpectCanonicalJson() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			canonical, err := canonicalJson(body)
+			must(t, err, append([]any{"failed to parse response body as JSON"}, extra...)...)
+
+			if i := firstDifference(canonical, body); i >= 0 {
+				args := []any{"offset", i, "expected", excerpt(canonical, i), "actual", excerpt(body, i)}
+				args = append(args, extra...)
+				fatal(t, "response JSON is not canonical", args...)
+			}
+		})
+	}
+}
+
+// ExpectJsonOnlyKeys asserts that the HTTP response has a JSON body with an
+// object at JSON path which has exactly the given keys. This is useful for
+// testing sparse fieldsets, e.g. that "?fields=id,name" returns only those.
+func (h *HttpTester) ExpectJsonOnlyKeys(path string, keys ...string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+
+			object, isObject := JsonContains(t, body, path, extra...).(map[string]any)
+			if !isObject {
+				fatal(t, "json path does not resolve to an object", extra...)
+				return
+			}
+
+			missing, unexpected := make([]string, 0), make([]string, 0)
+
+			for _, key := range keys {
+				if _, exists := object[key]; !exists {
+					missing = append(missing, key)
+				}
+			}
+
+			for key := range object {
+				if !contains(keys, key) {
+					unexpected = append(unexpected, key)
+				}
+			}
+
+			if len(missing) > 0 || len(unexpected) > 0 {
+				sort.Strings(unexpected)
+
+				args := []any{"missing", missing, "unexpected", unexpected}
+				args = append(args, extra...)
+				fatal(t, "JSON object does not have exactly the expected keys", args...)
+			}
+		})
+	}
+}
+
+// uuidFormat matches a UUID of any version, as per RFC 4122.
+var uuidFormat = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ExpectJsonUUID asserts that the HTTP response has a JSON body which contains a
+// UUID string at JSON path. Any UUID version is accepted.
+func (h *HttpTester) ExpectJsonUUID(path string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			jsonUUID(t, body, path, extra...)
+		})
+	}
+}
+
+// ExpectJsonUUIDVersion is like ExpectJsonUUID, but also requires the UUID to
+// be of a specific version, e.g. 4.
+func (h *HttpTester) ExpectJsonUUIDVersion(path string, version int) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			id := jsonUUID(t, body, path, extra...)
+
+			actual, _ := strconv.ParseInt(id[14:15], 16, 0)
+			if int(actual) != version {
+				args := []any{"json path", path, "value", id, "expected version", version, "actual version", actual}
+				args = append(args, extra...)
+				fatal(t, "UUID is not the expected version", args...)
+			}
+		})
+	}
+}
+
+// jsonUUID fatals unless body has a UUID string at JSON path, returning it.
+func jsonUUID(t TestingTB, body, path string, extra ...any) string {
+	t.Helper()
+
+	id := JsonContainsStr(t, body, path, extra...)
+	if !uuidFormat.MatchString(id) {
+		args := []any{"json path", path, "value", id}
+		args = append(args, extra...)
+		fatal(t, "value is not a valid UUID", args...)
+	}
+
+	return id
+}
+
+// ExpectJsonInt asserts that the HTTP response has a JSON body which contains an
+// integer at JSON path, i.e. a number with no fractional part which fits in an
+// int64. Unlike other JSON assertions, the number is checked as written rather
+// than as a float64, so precision is not lost for large values.
+func (h *HttpTester) ExpectJsonInt(path string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			jsonInt(t, body, path, extra...)
+		})
+	}
+}
+
+// ExpectJsonIntEquals is like ExpectJsonInt, but also requires the integer to
+// equal n.
+func (h *HttpTester) ExpectJsonIntEquals(path string, n int64) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+			equals(t, n, jsonInt(t, body, path, extra...), extra...)
+		})
+	}
+}
+
+// jsonInt fatals unless body has an integer at JSON path, returning it.
+func jsonInt(t TestingTB, body, path string, extra ...any) int64 {
+	t.Helper()
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	var data any
+	must(t, decoder.Decode(&data), extra...)
+
+	val := DataContains(t, data, path, extra...)
+
+	number, isNumber := val.(json.Number)
+	if !isNumber {
+		args := []any{"json path", path, "value", val}
+		args = append(args, extra...)
+		fatal(t, "value is not a number", args...)
+		return 0
+	}
+
+	n, err := strconv.ParseInt(number.String(), 10, 64)
+	if err == nil {
+		return n
+	}
+
+	// Allow integers written with a zero fraction or an exponent, e.g. 1.0, 1e3.
+	f, _ := number.Float64()
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f)
+	}
+
+	args := []any{"json path", path, "value", number}
+	args = append(args, extra...)
+	fatal(t, "value is not an int64", args...)
+
+	return 0
+}
+
+// ExpectFunc configures an HttpExpectation with a custom assertion, for
+// anything not covered by the other ExpectXXX functions. fn is given the test,
+// the response and its body, and should fail the test if its expectation is
+// not met.
+func (h *HttpTester) ExpectFunc(fn func(t TestingTB, response *http.Response, body string)) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			fn(t, response, body)
+		})
+	}
+}
+
+// ExpectDecodesWith asserts that the HTTP response has a body which decode can
+// decode into target, which must be a pointer. This allows for testing
+// responses in formats this package does not otherwise support, e.g.:
+//
+//	var out Message
+//	ht.Request("GET", "/message").Expect(ht.ExpectDecodesWith(msgpack.Unmarshal, &out)).Test()
+//
+// target is populated once the request is tested.
+func (h *HttpTester) ExpectDecodesWith(decode func(data []byte, v any) error, target any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if err := decode([]byte(body), target); err != nil {
+				args := []any{"error", err, "body", excerpt(body, 0)}
+				args = append(args, extra...)
+				fatal(t, "failed to decode response body", args...)
+			}
+		})
+	}
+}
+
+// Decode configures expectation to require a JSON body which decodes into a T,
+// returning the T to be populated once the request is tested. This allows for
+// asserting on responses with regular Go code, e.g.:
+//
+//	exp := ht.Request("GET", "/users/1").Expect(ht.ExpectCode(200))
+//	user := httptester.Decode[User](exp)
+//	exp.Test()
+//
+//	if user.Name != "Scotty" { ... }
+func Decode[T any](expectation *HttpExpectation) *T {
+	target := new(T)
+
+	expectation.request.tester.ExpectDecodesWith(json.Unmarshal, target)(expectation)
+
+	return target
+}
+
+// ExpectYamlMatch asserts that the HTTP response has a YAML body which contains a value
+// at JSON path which matches the parameter match.
+//
+// This convert YAML to JSON, then performs matching as per JSONPath.
+//
+// This makes no assertions on the response's content type, but will fail the test if
+// the content cannot be parsed as YAML.
+//
+// As with ExpectJsonMatch, numbers will be float64 in Go, but match may be of
+// any numeric type.
+func (h *HttpTester) ExpectYamlMatch(path string, match any) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("json path: %s", path)}, extra...)
+
+			var parsedData any
+			err := yaml.Unmarshal([]byte(body), &parsedData)
+			must(t, err, append([]any{"failed to decode response body as YAML"}, extra...))
+
+			equals(t, normaliseNumber(match), normaliseNumber(DataContains(t, parsedData, path, extra...)), extra...)
+		})
+	}
+}
+
+// ExpectDeterministic asserts that sending the request a second time produces a
+// byte-for-byte identical response body. This catches handlers which
+// accidentally include timestamps or random ordering in their output.
+func (h *HttpTester) ExpectDeterministic() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			_, second, _ := expectation.request.send(t, expectation.request.build(), false, nil, extra...)
+
+			sameBody(t, body, second, extra...)
+		})
+	}
+}
+
+// IdempotencyKey configures a HttpTesterRequest with an Idempotency-Key header,
+// as used by APIs to deduplicate retried requests. See ExpectIdempotent.
+func (h *HttpTester) IdempotencyKey(key string) RequestOption {
+	return h.Header("Idempotency-Key", key)
+}
+
+// ExpectIdempotent asserts that sending the request a second time produces the
+// same status and body. Combined with IdempotencyKey, this tests that a handler
+// deduplicates requests by key:
+//
+//	ht.Request("POST", "/payments", ht.IdempotencyKey("abc"), ht.JsonBody(payment)).Expect(ht.ExpectIdempotent()).Test()
+func (h *HttpTester) ExpectIdempotent() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			secondResponse, second, _ := expectation.request.send(t, expectation.request.build(), false, nil, extra...)
+
+			if secondResponse.StatusCode != response.StatusCode {
+				args := []any{"first", response.Status, "second", secondResponse.Status}
+				args = append(args, extra...)
+				fatal(t, "response status differs when requested again", args...)
+			}
+
+			sameBody(t, body, second, extra...)
+		})
+	}
+}
+
+// sameBody fatals unless first and second, the bodies of two responses to the
+// same request, are identical.
+func sameBody(t TestingTB, first, second string, extra ...any) {
+	t.Helper()
+
+	if i := firstDifference(first, second); i >= 0 {
+		args := []any{"offset", i, "first", excerpt(first, i), "second", excerpt(second, i)}
+		args = append(args, extra...)
+		fatal(t, "response body differs when requested again", args...)
+	}
+}
+
+// ExpectDeterministicJson is like ExpectDeterministic, but only requires that the
+// two response bodies are equal JSON, ignoring formatting and key order.
+func (h *HttpTester) ExpectDeterministicJson() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			_, second, _ := expectation.request.send(t, expectation.request.build(), false, nil, extra...)
+
+			first := MustParseJson[any](t, strings.NewReader(body), extra...)
+			if diff := jsonDiff("$", first, MustParseJson[any](t, strings.NewReader(second), extra...)); len(diff) > 0 {
+				args := []any{"diff", strings.Join(diff, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response JSON differs when requested again", args...)
+			}
+		})
+	}
+}
+
+// ExpectEquivalentTo asserts that the HTTP response has a JSON body equal to
+// that of other, which is sent when this expectation is tested. Values at each
+// of ignorePaths are removed from both before comparing. This is useful when
+// migrating to a new endpoint that must return the same data as an old one:
+//
+//	old := ht.Request("GET", "/v1/users")
+//	ht.Request("GET", "/v2/users").Expect(ht.ExpectEquivalentTo(old, "$.version")).Test()
+//
+// ignorePaths only support simple JSONPath child steps, e.g. $.id, $.items[*].createdAt.
+func (h *HttpTester) ExpectEquivalentTo(other *HttpTesterRequest, ignorePaths ...string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			other.done = true
+			other.finalise(extra...)
+			_, otherBody, _ := other.send(t, other.build(), false, nil, extra...)
+			other.passed = true
+
+			actual := MustParseJson[any](t, strings.NewReader(body), extra...)
+			expected := MustParseJson[any](t, strings.NewReader(otherBody), append([]any{"equivalent request"}, extra...)...)
+
+			actual = scrubJson(t, actual, ignorePaths, extra...)
+			expected = scrubJson(t, expected, ignorePaths, extra...)
+
+			if diff := jsonDiff("$", expected, actual); len(diff) > 0 {
+				args := []any{"equivalent to", fmt.Sprintf("%s %s", other.request.Method, other.request.URL.RequestURI()), "diff", strings.Join(diff, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response JSON is not equivalent", args...)
+			}
+		})
+	}
+}
+
+// TestHeadMatchesGet immediately tests both a HEAD and a GET request to path,
+// each configured by opts, asserting that the HEAD response has the same
+// Content-Type and Content-Length as the GET response, and no body.
+func (h *HttpTester) TestHeadMatchesGet(path string, opts ...RequestOption) {
+	h.t.Helper()
+
+	head := h.Request(http.MethodHead, path, opts...)
+	get := h.Request(http.MethodGet, path, opts...)
+
+	extra := []any{"path", path}
+
+	responses := make([]*http.Response, 0, 2)
+	for _, req := range []*HttpTesterRequest{head, get} {
+		req.done = true
+		req.finalise(extra...)
+
+		resp, body, _ := req.send(h.t, req.build(), false, nil, extra...)
+
+		if req == head && body != "" {
+			args := []any{"body", excerpt(body, 0)}
+			args = append(args, extra...)
+			fatal(h.t, "HEAD response has a body", args...)
+		}
+
+		responses = append(responses, resp)
+	}
+
+	diverged := make([]string, 0)
+	for _, name := range []string{"Content-Type", "Content-Length"} {
+		headVal, getVal := responses[0].Header.Get(name), responses[1].Header.Get(name)
+		if headVal != getVal {
+			diverged = append(diverged, fmt.Sprintf("%s: HEAD %q, GET %q", name, headVal, getVal))
+		}
+	}
+
+	if len(diverged) > 0 {
+		args := []any{"headers", strings.Join(diverged, "\n")}
+		args = append(args, extra...)
+		fatal(h.t, "HEAD response headers differ from GET", args...)
+	}
+
+	head.passed, get.passed = true, true
+}
+
+// TestIdempotentDelete immediately tests a DELETE request to path, configured
+// by opts, which must succeed with a 2xx status. The same DELETE is then sent
+// again, which must respond with repeatCode, e.g. http.StatusNotFound, or
+// http.StatusNoContent for APIs which treat repeated deletes as successful.
+func (h *HttpTester) TestIdempotentDelete(path string, repeatCode int, opts ...RequestOption) {
+	h.t.Helper()
+
+	h.Request(http.MethodDelete, path, opts...).Expect(h.ExpectSuccess()).Test("first DELETE")
+	h.Request(http.MethodDelete, path, opts...).Expect(h.ExpectCode(repeatCode)).Test("second DELETE")
+}
+
+// ExpectIncrementalFlush asserts that a streaming response is flushed to the
+// client as it is written, rather than being buffered until the handler
+// completes. This requires that the first part of the response body is received
+// within firstChunkWithin of the request being sent.
+//
+// The whole response is still read before this is checked, so a handler which
+// does not flush will fail only once it completes. Conversely, a handler which
+// completes within firstChunkWithin will pass regardless of whether it flushes,
+// so firstChunkWithin should be shorter than the time the handler takes to
+// stream its full response.
+func (h *HttpTester) ExpectIncrementalFlush(firstChunkWithin time.Duration) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		// Each time the request is sent, e.g. by TestEventually, is recorded
+		// afresh.
+		var recorder *flushRecorder
+
+		expectation.bodyWrappers = append(expectation.bodyWrappers, func(t TestingTB, body io.Reader, sent time.Time) io.Reader {
+			recorder = &flushRecorder{body: body, sent: sent}
+			return recorder
+		})
+
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if recorder == nil || recorder.first.IsZero() {
+				fatal(t, "response has no body to have flushed", extra...)
+				return
+			}
+
+			if firstChunk := recorder.first.Sub(recorder.sent); firstChunk > firstChunkWithin {
+				args := []any{"first chunk after", firstChunk, "expected within", firstChunkWithin, "completed after", recorder.last.Sub(recorder.sent)}
+				args = append(args, extra...)
+				fatal(t, "response was not flushed incrementally", args...)
+			}
+		})
+	}
+}
+
+// ExpectMaxBodySize asserts that the response body is no larger than n bytes.
+// At most n+1 bytes of the body are read, so this also protects the test from
+// unexpectedly large responses; expectations will only see the truncated body
+// if this fails.
+func (h *HttpTester) ExpectMaxBodySize(n int64) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.bodyWrappers = append(expectation.bodyWrappers, func(t TestingTB, body io.Reader, sent time.Time) io.Reader {
+			return io.LimitReader(body, n+1)
+		})
+
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if int64(len(body)) <= n {
+				return
+			}
+
+			var size any = "exceeded limit"
+			if response.ContentLength >= 0 {
+				size = response.ContentLength
+			}
+
+			args := []any{"limit", n, "size", size}
+			args = append(args, extra...)
+			fatal(t, "response body is too large", args...)
+		})
+	}
+}
+
+// ExpectFasterThan asserts that the response, including its body, is received
+// within d of the request being sent. This is a guardrail against slow
+// handlers rather than a precise measurement.
+func (h *HttpTester) ExpectFasterThan(d time.Duration) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if expectation.duration > d {
+				args := []any{"duration", expectation.duration, "limit", d}
+				args = append(args, extra...)
+				fatal(t, "response was too slow", args...)
+			}
+		})
+	}
+}
+
+// ExpectP95Under asserts that the 95th percentile response time of the request
+// is less than d. The request is sent again n times to measure this, so it
+// should be safe to repeat. This is a lightweight latency check, so timings
+// include the test client and are subject to noise on busy machines.
+func (h *HttpTester) ExpectP95Under(n int, d time.Duration) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			if n < 1 {
+				fatal(t, "ExpectP95Under() requires at least 1 request", extra...)
+				return
+			}
+
+			durations := make([]time.Duration, n)
+			for i := range durations {
+				_, _, durations[i] = expectation.request.send(t, expectation.request.build(), false, nil, extra...)
+			}
+
+			sorted := append([]time.Duration{}, durations...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+			// Nearest-rank percentile.
+			p95 := sorted[int(math.Ceil(0.95*float64(n)))-1]
+
+			if p95 >= d {
+				args := []any{"p95", p95, "limit", d, "durations", durations}
+				args = append(args, extra...)
+				fatal(t, "response time p95 is too slow", args...)
+			}
+		})
+	}
+}
+
+// ExpectHeaderBytesUnder asserts that the response's headers, as serialized on
+// the wire, total less than n bytes. Proxies and CDNs commonly reject responses
+// with large headers, e.g. due to oversized cookies.
+func (h *HttpTester) ExpectHeaderBytesUnder(n int) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			buf := &bytes.Buffer{}
+			must(t, response.Header.Write(buf), extra...)
+
+			if buf.Len() >= n {
+				args := []any{"limit", n, "size", buf.Len()}
+				args = append(args, extra...)
+				fatal(t, "response headers are too large", args...)
+			}
+		})
+	}
+}
+
+// flushRecorder records when a response body is received.
+type flushRecorder struct {
+	body        io.Reader
+	sent        time.Time
+	first, last time.Time
+}
+
+func (f *flushRecorder) Read(p []byte) (int, error) {
+	n, err := f.body.Read(p)
+
+	if n > 0 {
+		f.last = time.Now()
+		if f.first.IsZero() {
+			f.first = f.last
+		}
+	}
+
+	return n, err
+}
+
+// CaptureJson defines a capture against the response's JSON body. If
+// successful, this capture is available under name from HttpExpectation.Test.
+// Will fatal if there are no string value to capture, so this implies ExpectJsonExists.
+func (h *HttpTester) CaptureJson(name, jsonpath string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		h.t.Helper()
+
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			t.Helper()
+
+			return JsonContainsStr(t, body, jsonpath, extra...)
+		}
+	}
+}
+
+// CaptureJsonValue is like CaptureJson, but captures the value at jsonpath as
+// decoded JSON, e.g. a float64, bool, []any or map[string]any, rather than
+// requiring a string. These are returned separately by HttpExpectation.TestValues:
+//
+//	_, values := ht.Request("GET", "/stats").Expect(ht.CaptureJsonValue("count", "$.count")).TestValues()
+//	count := values["count"].(float64)
+func (h *HttpTester) CaptureJsonValue(name, jsonpath string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.valueCaptures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) any {
+			t.Helper()
+
+			return JsonContains(t, body, jsonpath, extra...)
+		}
+	}
+}
+
+// CaptureInto is like CaptureJsonValue, but decodes the value at jsonpath into
+// target, which must be a pointer. Fails if the value does not fit target's
+// type. E.g.:
+//
+//	var id int
+//	ht.Request("POST", "/users").Expect(ht.CaptureInto(&id, "$.id")).Test()
+func (h *HttpTester) CaptureInto(target any, jsonpath string) ResponseOption {
+	h.t.Helper()
+
+	if v := reflect.ValueOf(target); v.Kind() != reflect.Pointer || v.IsNil() {
+		fatal(h.t, "CaptureInto() requires a non-nil pointer", "target", fmt.Sprintf("%T", target))
+	}
+
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			// Numbers are decoded as written, so that large integers are exact.
+			decoder := json.NewDecoder(strings.NewReader(body))
+			decoder.UseNumber()
+
+			var data any
+			must(t, decoder.Decode(&data), extra...)
+
+			value := DataContains(t, data, jsonpath, extra...)
+
+			if err := json.Unmarshal([]byte(compactJson(value)), target); err != nil {
+				args := []any{"path", jsonpath, "value", compactJson(value), "target", fmt.Sprintf("%T", target), "error", err}
+				args = append(args, extra...)
+				fatal(t, "cannot capture JSON value into target", args...)
+			}
+		})
+	}
+}
+
+// CaptureBody captures the response's entire body under name.
+func (h *HttpTester) CaptureBody(name string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			return body
+		}
+	}
+}
+
+// CaptureBodyRegex captures part of the response's body under name, as matched
+// by the regular expression pattern. If pattern has a capturing group, the
+// first group is captured, else the whole match. E.g. to scrape a CSRF token:
+//
+//	ht.CaptureBodyRegex("csrf", `name="csrf" value="([^"]+)"`)
+func (h *HttpTester) CaptureBodyRegex(name, pattern string) ResponseOption {
+	h.t.Helper()
+
+	re, err := regexp.Compile(pattern)
+	must(h.t, err, "invalid pattern", pattern)
+
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			t.Helper()
+
+			match := re.FindStringSubmatch(body)
+			if match == nil {
+				args := []any{"pattern", pattern, "body", body}
+				args = append(args, extra...)
+				fatal(t, "body does not match pattern to capture", args...)
+				return ""
+			}
+
+			if len(match) > 1 {
+				return match[1]
+			}
+
+			return match[0]
+		}
+	}
+}
+
+// CaptureStatusCode captures the response's status code under name, e.g. "201".
+func (h *HttpTester) CaptureStatusCode(name string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			return strconv.Itoa(response.StatusCode)
+		}
+	}
+}
+
+// CaptureStatus captures the response's full status under name, including
+// the reason phrase, e.g. "201 Created".
+func (h *HttpTester) CaptureStatus(name string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			return response.Status
+		}
+	}
+}
+
+// CaptureHeader captures the value of the response's header headerName under
+// name, e.g. to reuse a Location or request ID in a later request. Fails if
+// the response does not have the header.
+func (h *HttpTester) CaptureHeader(name, headerName string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			t.Helper()
+
+			if values := response.Header.Values(headerName); len(values) > 0 {
+				return values[0]
+			}
+
+			present := make([]string, 0, len(response.Header))
+			for header := range response.Header {
+				present = append(present, header)
+			}
+			sort.Strings(present)
+
+			args := []any{"header", headerName, "present", present}
+			args = append(args, extra...)
+			fatal(t, "response does not have header to capture", args...)
+
+			return ""
+		}
+	}
+}
+
+// CaptureHeadersIgnore lists the response headers excluded by CaptureHeaders,
+// typically because they vary between otherwise identical responses.
+var CaptureHeadersIgnore = []string{"Date", "ETag"}
+
+// CaptureHeaders captures all of the response's headers under name, except
+// those in CaptureHeadersIgnore. Headers are serialized as on the wire, sorted
+// by name, so the capture is suitable for snapshot testing.
+func (h *HttpTester) CaptureHeaders(name string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			t.Helper()
+
+			exclude := make(map[string]bool, len(CaptureHeadersIgnore))
+			for _, header := range CaptureHeadersIgnore {
+				exclude[http.CanonicalHeaderKey(header)] = true
+			}
+
+			buf := &bytes.Buffer{}
+			must(t, response.Header.WriteSubset(buf, exclude), extra...)
+
+			return buf.String()
+		}
+	}
+}
+
+// TraceIDFormat is the format required of trace IDs by ExpectTraceID and
+// CaptureTraceID. This defaults to a W3C traceparent header value, but may be
+// changed to suit other tracing systems, e.g.:
+//
+//	httptester.TraceIDFormat = regexp.MustCompile(`^[0-9a-f]{32}$`)
+var TraceIDFormat = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// ExpectTraceID asserts that the response has a header headerName containing a
+// trace ID, as per TraceIDFormat.
+func (h *HttpTester) ExpectTraceID(headerName string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			traceID(t, response, headerName, extra...)
+		})
+	}
+}
+
+// CaptureTraceID is like ExpectTraceID, additionally capturing the trace ID
+// under name. This allows for testing that an ID propagates across requests.
+func (h *HttpTester) CaptureTraceID(name, headerName string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			t.Helper()
+
+			return traceID(t, response, headerName, extra...)
+		}
+	}
+}
+
+// traceID fatals unless response has a valid trace ID in header headerName,
+// returning it.
+func traceID(t TestingTB, response *http.Response, headerName string, extra ...any) string {
+	t.Helper()
+
+	id := response.Header.Get(headerName)
+	if !TraceIDFormat.MatchString(id) {
+		args := []any{"header", headerName, "value", id, "format", TraceIDFormat}
+		args = append(args, extra...)
+		fatal(t, "header does not contain a valid trace ID", args...)
+	}
+
+	return id
+}
+
+// HttpTesterRequest defines a request we're going to test against.
+type HttpTesterRequest struct {
+	request             *http.Request
+	tester              *HttpTester
+	done                bool
+	stack               []byte
+	multipartForm       *multipart.Writer
+	multipartFormBuffer *bytes.Buffer
+	bodyOption          string
+	body                []byte
+	timeout             time.Duration
+	delay               time.Duration
+	noRedirect          bool
+	gzip                bool
+	name                string
+	pathParams          bool
+	finalised           bool
+	passed              bool
+}
+
+// Name names the request, so that it is tested in a subtest of that name. This
+// requires that the HttpTester's TestingTB supports subtests, e.g. *testing.T,
+// else the request is tested as normal. E.g.:
+//
+//	ht.Request("POST", "/users", ht.JsonBody(user)).Name("create user").Expect(ht.ExpectCode(201)).Test()
+func (h *HttpTesterRequest) Name(name string) *HttpTesterRequest {
+	h.name = name
+	return h
+}
+
+// Expect returns a configured HttpExpectation to test against.
+func (h *HttpTesterRequest) Expect(options ...ResponseOption) *HttpExpectation {
+	expectation := h.newExpectation()
+
+	for _, opt := range h.tester.always {
+		opt(expectation)
 	}
 
 	for _, opt := range options {
@@ -346,24 +2431,78 @@ func (h *HttpTesterRequest) Expect(options ...ResponseOption) *HttpExpectation {
 	return expectation
 }
 
+// newExpectation returns an unconfigured HttpExpectation for this request.
+func (h *HttpTesterRequest) newExpectation() *HttpExpectation {
+	return &HttpExpectation{
+		request:              h,
+		responseExpectations: make([]responseExpectation, 0),
+		headerExpectations:   make(map[int]bool),
+		captures:             make(map[string]responseCapture),
+		valueCaptures:        make(map[string]valueCapture),
+	}
+}
+
 // ResponseOption is used to configure an HttpExpectation.
 type ResponseOption func(expectation *HttpExpectation)
 
-type responseExpectation func(response *http.Response, body string, extra ...any)
+// responseExpectation tests a response, reporting failures to t. This is the
+// TestingTB of the test, or of the current attempt, e.g. with TestEventually.
+type responseExpectation func(t TestingTB, response *http.Response, body string, extra ...any)
+
+// bodyWrapper wraps a response body as it is read, given the time at which the
+// request was sent. Failures while reading are reported to t.
+type bodyWrapper func(t TestingTB, body io.Reader, sent time.Time) io.Reader
+
+// responseCapture extracts a value from a response, failing the test if it can't.
+type responseCapture func(t TestingTB, response *http.Response, body string, extra ...any) string
+
+// valueCapture is like responseCapture, for values which are not strings.
+type valueCapture func(t TestingTB, response *http.Response, body string, extra ...any) any
 
 // HttpExpectation defines what we expect to receive after sending an
 // HttpTesterRequest, plus any data we want to pull out of it.
 type HttpExpectation struct {
 	request              *HttpTesterRequest
 	responseExpectations []responseExpectation
-	jsonCaptures         map[string]string
+	captures             map[string]responseCapture
+	valueCaptures        map[string]valueCapture
+	headerExpectations   map[int]bool
+	bodyWrappers         []bodyWrapper
+	keepCompressed       bool
+	duration             time.Duration
 }
 
 func (h *HttpExpectation) addExpectation(expectation responseExpectation) {
 	h.responseExpectations = append(h.responseExpectations, expectation)
 }
 
+// addHeaderExpectation adds an expectation which only tests the response's
+// status and headers, so can be tested before its body is read.
+func (h *HttpExpectation) addHeaderExpectation(expectation responseExpectation) {
+	h.headerExpectations[len(h.responseExpectations)] = true
+	h.addExpectation(expectation)
+}
+
+// setBody sets the request's body, as configured by the named option. A request
+// cannot have both a body and a multipart form, as only one of them would be
+// sent.
+func (h *HttpTesterRequest) setBody(option string, body io.Reader) {
+	if h.multipartForm != nil {
+		h.tester.t.Helper()
+		fatal(h.tester.t, fmt.Sprintf("%s cannot be combined with a multipart form", option))
+		return
+	}
+
+	h.bodyOption = option
+	h.request.Body = io.NopCloser(body)
+}
+
 func (h *HttpTesterRequest) multipart() *multipart.Writer {
+	if h.bodyOption != "" {
+		h.tester.t.Helper()
+		fatal(h.tester.t, fmt.Sprintf("a multipart form cannot be combined with %s", h.bodyOption))
+	}
+
 	if h.multipartForm == nil {
 		h.multipartFormBuffer = &bytes.Buffer{}
 		h.multipartForm = multipart.NewWriter(h.multipartFormBuffer)
@@ -372,18 +2511,147 @@ func (h *HttpTesterRequest) multipart() *multipart.Writer {
 	return h.multipartForm
 }
 
-func (h *HttpTesterRequest) finalise() *http.Request {
-	if h.multipartForm == nil {
-		return h.request
+// finalise completes the configuration of the request, ready to be sent
+// (possibly several times) via build.
+func (h *HttpTesterRequest) finalise(extra ...any) {
+	t := h.tester.t
+	t.Helper()
+
+	// A request may be finalised more than once, e.g. by an expectation which
+	// is retried, but must only be prepared once.
+	if h.finalised {
+		return
+	}
+	h.finalised = true
+
+	if h.multipartForm != nil {
+		// Finish and attach a multipart form if we have started one.
+		must(t, h.multipartForm.Close(), extra...)
+		h.request.Body = io.NopCloser(h.multipartFormBuffer)
+
+		h.request.Header.Set("Content-Type", h.multipartForm.FormDataContentType())
+	}
+
+	// Buffer the body so that the request can be replayed.
+	if h.request.Body != nil {
+		body, err := io.ReadAll(h.request.Body)
+		must(t, err, extra...)
+		must(t, h.request.Body.Close(), extra...)
+		h.body = body
+		h.request.Body = nil
+	}
+
+	if h.gzip && h.body != nil {
+		h.gzipBody(extra...)
+	}
+
+	if h.pathParams {
+		if unresolved := pathParamPlaceholder.FindAllString(h.request.URL.Path, -1); len(unresolved) > 0 {
+			args := []any{"placeholders", unresolved, "path", h.request.URL.Path}
+			args = append(args, extra...)
+			fatal(t, "path has unresolved parameters", args...)
+		}
+	}
+
+	var err error
+	h.request.URL, err = h.request.URL.Parse(h.tester.srv.URL + h.request.URL.String())
+	must(t, err, extra...)
+}
+
+// build returns a new *http.Request for a finalised request. Each has its own
+// copy of the body, so this may be called multiple times to send the same
+// request more than once.
+func (h *HttpTesterRequest) build() *http.Request {
+	r := h.request.Clone(h.request.Context())
+
+	if h.body != nil {
+		r.ContentLength = int64(len(h.body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(h.body)), nil
+		}
+		r.Body, _ = r.GetBody()
+	}
+
+	return r
+}
+
+// send executes r, returning the response with its body read through each of
+// wrappers, after decompressing it if required. The response's body is replaced
+// so that it can be read again. Failures are reported to t.
+func (h *HttpTesterRequest) send(t TestingTB, r *http.Request, decompressBody bool, wrappers []bodyWrapper, extra ...any) (*http.Response, string, time.Duration) {
+	t.Helper()
+
+	start := time.Now()
+	resp, cancel := h.do(t, r, extra...)
+	defer cancel()
+
+	var bodyReader io.Reader = resp.Body
+	if decompressBody {
+		bodyReader = decompress(resp, bodyReader)
+	}
+
+	for _, wrap := range wrappers {
+		bodyReader = wrap(t, bodyReader, start)
+	}
+
+	body, err := io.ReadAll(bodyReader)
+	h.mustNotTimeout(t, err, extra...)
+	duration := time.Since(start)
+
+	// Replace the body so it can be read again.
+	must(t, resp.Body.Close())
+	resp.Body = io.NopCloser(bytes.NewBuffer(body))
+
+	return resp, string(body), duration
+}
+
+// do executes r without reading the response's body, which must be read before
+// calling the returned function to release the request's resources. Calling it
+// early aborts the request. Failures are reported to t.
+func (h *HttpTesterRequest) do(t TestingTB, r *http.Request, extra ...any) (*http.Response, context.CancelFunc) {
+	t.Helper()
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(r.Context(), h.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(r.Context())
 	}
+	r = r.WithContext(ctx)
 
-	// Finish and attach a multipart form if we have started one.
-	must(h.tester.t, h.multipartForm.Close())
-	h.request.Body = io.NopCloser(h.multipartFormBuffer)
+	client := h.tester.client
+	if h.noRedirect {
+		noRedirectClient := *client
+		noRedirectClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		client = &noRedirectClient
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		cancel()
+	}
+	h.mustNotTimeout(t, err, extra...)
 
-	h.request.Header.Set("Content-Type", h.multipartForm.FormDataContentType())
+	return resp, cancel
+}
+
+// mustNotTimeout is like must, but reports a clearer failure if err is due to the
+// request's deadline being exceeded.
+func (h *HttpTesterRequest) mustNotTimeout(t TestingTB, err error, extra ...any) {
+	t.Helper()
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		if h.timeout > 0 {
+			fatal(t, fmt.Sprintf("request deadline exceeded: no response within %s", h.timeout), extra...)
+		} else {
+			fatal(t, "request deadline exceeded", extra...)
+		}
+	}
 
-	return h.request
+	must(t, err, extra...)
 }
 
 // MaxReqRespOutput is used when reporting test failures. The maximum amount
@@ -395,34 +2663,93 @@ var MaxReqRespOutput = 1200
 func (h *HttpExpectation) Test(extra ...any) (captures map[string]string) {
 	h.request.tester.t.Helper()
 
+	captures, _ = h.TestValues(extra...)
+
+	return captures
+}
+
+// TestValues is like Test, additionally returning values captured by
+// CaptureJsonValue.
+func (h *HttpExpectation) TestValues(extra ...any) (captures map[string]string, values map[string]any) {
+	h.request.tester.t.Helper()
+
+	result := h.TestResponse(extra...)
+
+	return result.Captures, result.Values
+}
+
+// HttpExpectationResult describes the response to a tested request.
+type HttpExpectationResult struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+	// Duration is the time taken to send the request and read the response.
+	Duration time.Duration
+	// Captures are the values captured by CaptureXXX options, as per Test.
+	Captures map[string]string
+	// Values are the values captured by CaptureJsonValue, as per TestValues.
+	Values map[string]any
+}
+
+// TestResponse is like Test, but returns the response along with its captures.
+// This is useful for follow-up logic that depends on the response, e.g.:
+//
+//	result := ht.Request("POST", "/jobs").Expect(ht.ExpectSuccess()).TestResponse()
+//	if result.StatusCode == http.StatusAccepted { ... }
+func (h *HttpExpectation) TestResponse(extra ...any) *HttpExpectationResult {
+	h.request.tester.t.Helper()
+
 	h.request.done = true
 
-	r := h.request.finalise()
-	srv := h.request.tester.srv
-	t := h.request.tester.t
+	// If the subtest fails, callers still receive an empty result.
+	result := &HttpExpectationResult{Captures: map[string]string{}, Values: map[string]any{}}
 
-	var err error
-	r.URL, err = r.URL.Parse(srv.URL + r.URL.String())
-	must(t, err, extra...)
+	h.request.named(func() {
+		h.request.tester.t.Helper()
 
-	if reqData, err := httputil.DumpRequest(r, true); err == nil {
-		l, _ := fbrmath.Min(MaxReqRespOutput, len(reqData))
-		extra = append(extra, "HTTP request:", string(reqData[0:l]))
+		result = h.test(extra...)
+	})
+
+	return result
+}
+
+// named calls fn in a subtest named by Name, if the request has a name, else
+// calls fn directly.
+func (h *HttpTesterRequest) named(fn func()) {
+	h.tester.t.Helper()
+
+	if h.name == "" {
+		fn()
+		return
 	}
 
-	resp, err := h.request.tester.client.Do(r)
-	must(t, err, extra...)
+	h.tester.subtest(h.name, fn)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	must(t, err, extra...)
+// test finalises and tests the request once.
+func (h *HttpExpectation) test(extra ...any) *HttpExpectationResult {
+	h.request.tester.t.Helper()
 
-	// Replace the body so it can be read again.
-	must(t, resp.Body.Close())
-	resp.Body = io.NopCloser(bytes.NewBuffer(body))
+	h.request.finalise(extra...)
+
+	result := h.attempt(h.request.tester.t, extra...)
+
+	h.request.passed = true
+
+	return result
+}
+
+// attempt sends a finalised request once, evaluating expectations and captures
+// against its response. Failures are reported to t.
+func (h *HttpExpectation) attempt(t TestingTB, extra ...any) *HttpExpectationResult {
+	t.Helper()
 
-	bodyStr := string(body)
+	r, extra := h.begin(extra...)
 
-	if respData, err := httputil.DumpResponse(resp, true); err == nil {
+	resp, bodyStr, duration := h.request.send(t, r, !h.keepCompressed, h.bodyWrappers, extra...)
+	h.duration = duration
+
+	if respData, err := dumpResponse(resp, bodyStr); err == nil {
 		l, _ := fbrmath.Min(MaxReqRespOutput, len(respData))
 		extra = append(extra, "HTTP response:", string(respData[0:l]))
 	} else {
@@ -430,16 +2757,68 @@ func (h *HttpExpectation) Test(extra ...any) (captures map[string]string) {
 	}
 
 	for _, expectation := range h.responseExpectations {
-		expectation(resp, bodyStr, extra...)
+		expectation(t, resp, bodyStr, extra...)
 	}
 
-	captures = make(map[string]string)
+	captures := make(map[string]string)
 
-	for name, expr := range h.jsonCaptures {
-		captures[name] = JsonContainsStr(t, bodyStr, expr, extra...)
+	for name, capture := range h.captures {
+		captures[name] = capture(t, resp, bodyStr, extra...)
+		h.request.tester.captures[name] = captures[name]
 	}
 
-	return captures
+	values := make(map[string]any)
+
+	for name, capture := range h.valueCaptures {
+		values[name] = capture(t, resp, bodyStr, extra...)
+	}
+
+	if h.request.tester.verbose {
+		t.Log(fmt.Sprintf("%s %s -> %d (%s)", r.Method, r.URL.RequestURI(), resp.StatusCode, duration.Round(time.Millisecond)))
+	}
+
+	return &HttpExpectationResult{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       bodyStr,
+		Duration:   duration,
+		Captures:   captures,
+		Values:     values,
+	}
+}
+
+// begin builds a finalised request, ready to be sent after the request's delay.
+// Returns extra with the request added, for failure output.
+func (h *HttpExpectation) begin(extra ...any) (*http.Request, []any) {
+	r := h.request.build()
+
+	if reqData, err := httputil.DumpRequest(r, true); err == nil {
+		l, _ := fbrmath.Min(MaxReqRespOutput, len(reqData))
+		extra = append(extra, "HTTP request:", string(reqData[0:l]))
+	}
+
+	time.Sleep(h.request.delay)
+
+	return r, extra
+}
+
+// dumpResponse is like httputil.DumpResponse, but indents a JSON body so that
+// it is easier to read in failure output. Invalid JSON is dumped as is.
+func dumpResponse(resp *http.Response, body string) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	isJson := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+
+	pretty := &bytes.Buffer{}
+	if !isJson || json.Indent(pretty, []byte(body), "", "  ") != nil {
+		return httputil.DumpResponse(resp, true)
+	}
+
+	head, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(head, pretty.Bytes()...), nil
 }
 
 // stringifyReader will extract a string from data if it can, returning that string
@@ -450,17 +2829,13 @@ func (h *HttpExpectation) Test(extra ...any) (captures map[string]string) {
 func (h *HttpTester) stringifyReader(data any) (string, bool) {
 	h.t.Helper()
 
-	var bodyStr string
-
 	if asReader, isReader := data.(io.Reader); isReader {
 		bodyBytes, err := io.ReadAll(asReader)
 		must(h.t, err)
-		bodyStr = string(bodyBytes)
+		return string(bodyBytes), true
 	}
 
-	var isStr bool
-
-	bodyStr, isStr = data.(string)
+	bodyStr, isStr := data.(string)
 
 	return bodyStr, isStr
 }
@@ -1,10 +1,22 @@
 package httptester_test
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/vaeryn-uk/go-httptester"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
 )
 
 var exampleJson = []map[string]any{
@@ -112,3 +124,1869 @@ func (e *exampleTestRunner) Fatal(args ...any) {
 func (e *exampleTestRunner) Log(args ...any) {
 	fmt.Println(args...)
 }
+
+// recordingTB records a test failure rather than failing the real test, halting
+// the calling goroutine as testing.T would.
+type recordingTB struct {
+	*testing.T
+	failure  string
+	logs     []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Log(args ...any) {
+	r.logs = append(r.logs, fmt.Sprint(args...))
+}
+
+func (r *recordingTB) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recordingTB) Fatal(args ...any) {
+	if r.failure == "" {
+		r.failure = fmt.Sprint(args...)
+	}
+	runtime.Goexit()
+}
+
+// runRecorded runs fn against a recordingTB in its own goroutine, returning
+// the failure message it produced, if any.
+func runRecorded(t *testing.T, fn func(tb httptester.TestingTB)) string {
+	t.Helper()
+
+	return runRecordedTB(t, fn).failure
+}
+
+// runRecordedTB is like runRecorded, but returns the recordingTB itself.
+func runRecordedTB(t *testing.T, fn func(tb httptester.TestingTB)) *recordingTB {
+	t.Helper()
+
+	tb := &recordingTB{T: t}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer func() {
+			for i := len(tb.cleanups) - 1; i >= 0; i-- {
+				tb.cleanups[i]()
+			}
+		}()
+
+		fn(tb)
+	}()
+
+	<-done
+
+	return tb
+}
+
+// expectFailure fails t unless fn produces a test failure containing msg.
+func expectFailure(t *testing.T, msg string, fn func(tb httptester.TestingTB)) {
+	t.Helper()
+
+	failure := runRecorded(t, fn)
+	if failure == "" {
+		t.Fatalf("expected a failure containing %q, but passed", msg)
+	}
+
+	if !strings.Contains(failure, msg) {
+		t.Fatalf("expected a failure containing %q, got:\n%s", msg, failure)
+	}
+}
+
+// expectPass fails t if fn produces a test failure.
+func expectPass(t *testing.T, fn func(tb httptester.TestingTB)) {
+	t.Helper()
+
+	if failure := runRecorded(t, fn); failure != "" {
+		t.Fatalf("expected to pass, got:\n%s", failure)
+	}
+}
+
+// newTester returns a tester against a new server for handler.
+func newTester(tb httptester.TestingTB, handler http.Handler, options ...httptester.TesterOption) *httptester.HttpTester {
+	return httptester.New(tb, httptester.Server(tb, handler), options...)
+}
+
+// echoHandler replies with the request's content type and body.
+func echoHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		writer.Header().Set("Content-Type", request.Header.Get("Content-Type"))
+		_, _ = writer.Write(body)
+	})
+}
+
+func TestExpectSingleHeader(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Add("X-Single", "a")
+		writer.Header().Add("X-Double", "a")
+		writer.Header().Add("X-Double", "b")
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectSingleHeader("X-Single")).Test()
+	})
+
+	expectFailure(t, "expected header exactly once", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectSingleHeader("X-Double")).Test()
+	})
+}
+
+func TestVerbose(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusCreated)
+	})
+
+	tb := runRecordedTB(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/quiet").Expect().Test()
+
+		ht.Verbose(true)
+		ht.Request("POST", "/users/1?x=y").Expect().Test()
+	})
+
+	if tb.failure != "" {
+		t.Fatal(tb.failure)
+	}
+
+	if len(tb.logs) != 1 || !strings.HasPrefix(tb.logs[0], "POST /users/1?x=y -> 201 (") {
+		t.Fatalf("unexpected logs: %q", tb.logs)
+	}
+}
+
+func TestJsonPatchBodies(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+
+		ht.Request("PATCH", "/", ht.JsonMergePatchBody(map[string]any{"name": "Scotty"})).
+			Expect(ht.ExpectContentType("application/merge-patch+json"), ht.ExpectJsonMatchStr("$.name", "Scotty")).
+			Test()
+
+		ht.Request("PATCH", "/", ht.JsonPatchBody([]any{map[string]any{"op": "remove", "path": "/name"}})).
+			Expect(ht.ExpectContentType("application/json-patch+json"), ht.ExpectJsonMatchStr("$[0].op", "remove")).
+			Test()
+	})
+}
+
+func TestExpectDeterministic(t *testing.T) {
+	calls := 0
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Has("vary") {
+			calls++
+		}
+		body, _ := io.ReadAll(request.Body)
+		_, _ = fmt.Fprintf(writer, `{"body":%q,"n":%d}`, body, calls%2)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.Body("same body")).Expect(ht.ExpectDeterministicJson()).Test()
+	})
+
+	expectFailure(t, "$.n: expected 1, actual 0", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/?vary", ht.Body("same body")).Expect(ht.ExpectDeterministicJson()).Test()
+	})
+
+	expectFailure(t, "response body differs when requested again", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/?vary", ht.Body("same body")).Expect(ht.ExpectDeterministic()).Test()
+	})
+}
+
+func TestTraceID(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Traceparent", request.URL.Query().Get("trace"))
+	})
+
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		captures := ht.Request("GET", "/?trace="+valid).
+			Expect(ht.ExpectTraceID("Traceparent"), ht.CaptureTraceID("trace", "Traceparent")).
+			Test()
+
+		if captures["trace"] != valid {
+			tb.Fatal("unexpected capture", captures)
+		}
+	})
+
+	expectFailure(t, "header does not contain a valid trace ID", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?trace=abc").Expect(ht.ExpectTraceID("Traceparent")).Test()
+	})
+}
+
+func TestExpectJsonUUID(t *testing.T) {
+	body := `{"v4":"f47ac10b-58cc-4372-a567-0e02b2c3d479","v1":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","bad":"f47ac10b-58cc"}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonUUID("$.v1"), ht.ExpectJsonUUIDVersion("$.v4", 4)).
+			Test()
+	})
+
+	expectFailure(t, "value is not a valid UUID", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonUUID("$.bad")).Test()
+	})
+
+	expectFailure(t, "UUID is not the expected version", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonUUIDVersion("$.v1", 4)).Test()
+	})
+}
+
+func TestRawBodyFromCapture(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/export", ht.JsonBody(`{"name":"Scotty"}`)).Expect(ht.CaptureBody("export")).Test()
+
+		ht.Request("POST", "/import", ht.RawBodyFromCapture("application/vnd.test+json", "export")).
+			Expect(ht.ExpectContentType("application/vnd.test+json"), ht.ExpectJsonMatchStr("$.name", "Scotty")).
+			Test()
+
+		if ht.Captures()["export"] != `{"name":"Scotty"}` {
+			tb.Fatal("unexpected captures", ht.Captures())
+		}
+	})
+
+	expectFailure(t, "no value has been captured with this name", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/import", ht.RawBodyFromCapture("application/json", "missing")).Expect().Test()
+	})
+}
+
+func TestExpectConnectionClosed(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Has("close") {
+			writer.Header().Set("Connection", "close")
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?close").Expect(ht.ExpectConnectionClosed()).Test()
+		ht.Request("GET", "/", ht.Close()).Expect(ht.ExpectConnectionClosed()).Test()
+	})
+
+	expectFailure(t, "expected the server to close the connection", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectConnectionClosed()).Test()
+	})
+}
+
+func TestExpectJsonMatches(t *testing.T) {
+	body := `{"name":"Scotty","age":30,"tags":["a"]}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonMatches(map[string]any{"$.name": "Scotty", "$.age": 30.0, "$.tags[0]": "a"})).
+			Test()
+	})
+
+	failure := runRecorded(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonMatches(map[string]any{"$.name": "Kirk", "$.age": 30.0, "$.missing": "a"})).
+			Test()
+	})
+
+	if !strings.Contains(failure, "$.missing: unknown key missing\n$.name: expected Kirk, actual Scotty") {
+		t.Fatal("unexpected failure", failure)
+	}
+}
+
+func TestExpectLongPoll(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		wait, _ := time.ParseDuration(request.URL.Query().Get("wait"))
+
+		select {
+		case <-time.After(wait):
+			_, _ = writer.Write([]byte("event"))
+		case <-request.Context().Done():
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?wait=10ms").
+			Expect(ht.ExpectLongPoll(time.Second, ht.ExpectBodyContains("event"))).
+			Test()
+	})
+
+	expectFailure(t, "request deadline exceeded: no response within 20ms", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?wait=1s").
+			Expect(ht.ExpectLongPoll(20*time.Millisecond, ht.ExpectBodyContains("event"))).
+			Test()
+	})
+}
+
+func TestExpectReceivedBodyLength(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		limit, _ := strconv.ParseInt(request.URL.Query().Get("limit"), 10, 64)
+		n, _ := io.Copy(io.Discard, io.LimitReader(request.Body, limit))
+		_ = json.NewEncoder(writer).Encode(map[string]any{"received": n})
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/?limit=100", ht.Body("0123456789")).Expect(ht.ExpectReceivedBodyLength("$.received")).Test()
+	})
+
+	expectFailure(t, "handler did not receive the full request body", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/?limit=5", ht.Body("0123456789")).Expect(ht.ExpectReceivedBodyLength("$.received")).Test()
+	})
+}
+
+func TestExpectJsonArrayElement(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+
+		var element any
+		ht.Request("POST", "/", ht.JsonBody(`{"items":["a","b"]}`)).
+			Expect(ht.ExpectJsonArrayElement("$.items", 1, func(e any) { element = e })).
+			Test()
+
+		if element != "b" {
+			tb.Fatal("unexpected element", element)
+		}
+	})
+
+	expectFailure(t, "array index out of range", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`{"items":["a","b"]}`)).
+			Expect(ht.ExpectJsonArrayElement("$.items", 2, func(e any) {})).
+			Test()
+	})
+}
+
+func TestWithCookieJar(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/login" {
+			http.SetCookie(writer, &http.Cookie{Name: "session", Value: "abc"})
+			return
+		}
+
+		if cookie, err := request.Cookie("session"); err == nil {
+			_, _ = writer.Write([]byte(cookie.Value))
+		} else {
+			_, _ = writer.Write([]byte("anonymous"))
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		srv := httptester.Server(tb, handler)
+
+		ht := httptester.New(tb, srv, httptester.WithCookieJar())
+		ht.Request("POST", "/login").Expect().Test()
+		ht.Request("GET", "/me").Expect(ht.ExpectBodyContains("abc")).Test()
+
+		// A separate tester does not share the session.
+		other := httptester.New(tb, srv, httptester.WithCookieJar())
+		other.Request("GET", "/me").Expect(other.ExpectBodyContains("anonymous")).Test()
+
+		// The jar is kept on a custom client.
+		custom := httptester.New(tb, srv, httptester.WithClient(srv.Client()), httptester.WithCookieJar())
+		custom.Request("POST", "/login").Expect().Test()
+		custom.Request("GET", "/me").Expect(custom.ExpectBodyContains("abc")).Test()
+
+		// Regardless of the order of options.
+		reversed := httptester.New(tb, srv, httptester.WithCookieJar(), httptester.WithClient(srv.Client()))
+		reversed.Request("POST", "/login").Expect().Test()
+		reversed.Request("GET", "/me").Expect(reversed.ExpectBodyContains("abc")).Test()
+	})
+}
+
+func TestExpectJsonEqualsStruct(t *testing.T) {
+	type address struct {
+		Street string `json:"street"`
+	}
+
+	type user struct {
+		Name    string   `json:"name"`
+		Age     int      `json:"age"`
+		Address *address `json:"address"`
+	}
+
+	body := `{"name":"Scotty","age":30,"address":{"street":"Fake Street"}}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonEqualsStruct(user{Name: "Scotty", Age: 30, Address: &address{Street: "Fake Street"}})).
+			Test()
+	})
+
+	expectFailure(t, `user.Address.Street: expected "Real Street", actual "Fake Street"`, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonEqualsStruct(user{Name: "Scotty", Age: 30, Address: &address{Street: "Real Street"}})).
+			Test()
+	})
+
+	type event struct {
+		At   time.Time `json:"at"`
+		Link url.URL   `json:"link"`
+	}
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	eventBody := `{"at":"2020-01-02T04:04:05+01:00","link":{"Scheme":"https","Host":"example.com","User":{}}}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(eventBody)).
+			Expect(ht.ExpectJsonEqualsStruct(event{At: at, Link: url.URL{Scheme: "https", Host: "example.com", User: &url.Userinfo{}}})).
+			Test()
+	})
+
+	expectFailure(t, "event.At: expected", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(eventBody)).
+			Expect(ht.ExpectJsonEqualsStruct(event{At: at.Add(time.Hour), Link: url.URL{Scheme: "https", Host: "example.com", User: &url.Userinfo{}}})).
+			Test()
+	})
+
+	expectFailure(t, "event.Link.User: expected", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(eventBody)).
+			Expect(ht.ExpectJsonEqualsStruct(event{At: at, Link: url.URL{Scheme: "https", Host: "example.com", User: url.User("kirk")}})).
+			Test()
+	})
+
+	expectFailure(t, "expected struct must not be nil", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonEqualsStruct(nil)).Test()
+	})
+}
+
+func TestExpectIncrementalFlush(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		for i := 0; i < 5; i++ {
+			_, _ = fmt.Fprintf(writer, "chunk %d\n", i)
+			if request.URL.Query().Has("flush") {
+				writer.(http.Flusher).Flush()
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?flush").Expect(ht.ExpectIncrementalFlush(50 * time.Millisecond)).Test()
+	})
+
+	expectFailure(t, "response was not flushed incrementally", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectIncrementalFlush(50 * time.Millisecond)).Test()
+	})
+
+	// Each attempt is timed separately: only the first is flushed promptly,
+	// and it does not have the expected body.
+	var calls int32
+	slowingHandler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			_, _ = writer.Write([]byte("pending"))
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		_, _ = writer.Write([]byte("done"))
+	})
+
+	expectFailure(t, "response was not flushed incrementally", func(tb httptester.TestingTB) {
+		ht := newTester(tb, slowingHandler)
+		ht.Request("GET", "/").
+			Expect(ht.ExpectIncrementalFlush(50*time.Millisecond), ht.ExpectBodyContains("done")).
+			TestEventually(300*time.Millisecond, 10*time.Millisecond)
+	})
+}
+
+func TestCaptureStatus(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusCreated)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		captures := ht.Request("POST", "/").Expect(ht.CaptureStatus("status"), ht.CaptureStatusCode("code")).Test()
+
+		if captures["status"] != "201 Created" || captures["code"] != "201" {
+			tb.Fatal("unexpected captures", captures)
+		}
+	})
+}
+
+func TestExpectJsonShapeOf(t *testing.T) {
+	type base struct {
+		ID int `json:"id"`
+	}
+
+	type user struct {
+		base
+		Name     string            `json:"name"`
+		Nickname string            `json:"nickname,omitempty"`
+		Tags     []string          `json:"tags"`
+		Meta     map[string]int    `json:"meta"`
+		Created  time.Time         `json:"created"`
+		Count    int64             `json:"count,string"`
+		Ignored  func()            `json:"-"`
+		Extra    map[string]string `json:"extra,omitempty"`
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`{"id":1,"name":"a","tags":["x"],"meta":{"a":1},"created":"2020-01-01T00:00:00Z","count":"3","other":true}`)).
+			Expect(ht.ExpectJsonShapeOf(user{})).
+			Test()
+	})
+
+	failure := runRecorded(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`{"id":"1","tags":[1],"meta":null,"created":5,"count":3}`)).
+			Expect(ht.ExpectJsonShapeOf(&user{})).
+			Test()
+	})
+
+	for _, msg := range []string{
+		"$.id: expected number (int), actual string",
+		"$.name: missing, expected string",
+		"$.tags[0]: expected string (string), actual number",
+		"$.created: expected string (time.Time), actual number",
+		"$.count: expected string (int64), actual number",
+	} {
+		if !strings.Contains(failure, msg) {
+			t.Errorf("expected failure to contain %q, got:\n%s", msg, failure)
+		}
+	}
+
+	expectFailure(t, "prototype must not be nil", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`{"id":1}`)).Expect(ht.ExpectJsonShapeOf(nil)).Test()
+	})
+}
+
+func TestExpectMaxBodySize(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body("12345")).Expect(ht.ExpectMaxBodySize(5)).Test()
+	})
+
+	expectFailure(t, "response body is too large", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body("123456")).Expect(ht.ExpectMaxBodySize(5)).Test()
+	})
+
+	// The limit applies to the decompressed body of a gzip response.
+	gzipHandler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		writer.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(writer)
+		_, _ = gz.Write(body)
+		_ = gz.Close()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, gzipHandler)
+		ht.Request("POST", "/", ht.Body("12345")).Expect(ht.ExpectMaxBodySize(5), ht.ExpectBodyContains("12345")).Test()
+	})
+
+	expectFailure(t, "response body is too large", func(tb httptester.TestingTB) {
+		ht := newTester(tb, gzipHandler)
+		ht.Request("POST", "/", ht.Body(strings.Repeat("1", 1000))).Expect(ht.ExpectMaxBodySize(5)).Test()
+	})
+}
+
+func TestExpectEquivalentTo(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		name := "Scotty"
+		if request.URL.Path == "/eventually" {
+			mu.Lock()
+			calls++
+			if calls < 3 {
+				name = "pending"
+			}
+			mu.Unlock()
+		}
+
+		_, _ = fmt.Fprintf(writer, `{"version":%q,"users":[{"name":%q}]}`, request.URL.Path, name)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		old := ht.Request("GET", "/v1")
+		ht.Request("GET", "/v2").Expect(ht.ExpectEquivalentTo(old, "$.version")).Test()
+	})
+
+	expectFailure(t, `$.version: expected "/v1", actual "/v2"`, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		old := ht.Request("GET", "/v1")
+		ht.Request("GET", "/v2").Expect(ht.ExpectEquivalentTo(old)).Test()
+	})
+
+	// The other request is sent again on each attempt.
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		old := ht.Request("POST", "/v1", ht.JsonBody(map[string]any{"page": 1}))
+		ht.Request("GET", "/eventually").
+			Expect(ht.ExpectEquivalentTo(old, "$.version")).
+			TestEventually(time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestExpectCreated(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Has("location") {
+			writer.Header().Set("Location", "/users/1")
+		}
+		writer.WriteHeader(http.StatusCreated)
+		_, _ = writer.Write([]byte(`{"id":1,"empty":""}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/?location").Expect(ht.ExpectCreated(true, "$.id")).Test()
+		ht.Request("POST", "/").Expect(ht.ExpectCreated(false, "$.id")).Test()
+	})
+
+	expectFailure(t, "expected a Location header", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/").Expect(ht.ExpectCreated(true, "$.id")).Test()
+	})
+
+	expectFailure(t, "expected a non-empty ID", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/").Expect(ht.ExpectCreated(false, "$.empty")).Test()
+	})
+}
+
+func TestExpectAuthChallenge(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+		writer.WriteHeader(http.StatusUnauthorized)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectAuthChallenge("bearer"), ht.ExpectAuthChallengeRealm("Bearer", "api")).Test()
+	})
+
+	expectFailure(t, "response does not have the expected authentication challenge", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectAuthChallenge("Basic")).Test()
+	})
+
+	expectFailure(t, "response does not have the expected authentication challenge", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectAuthChallengeRealm("Bearer", "admin")).Test()
+	})
+}
+
+func TestMalformedJsonBody(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Content-Type") != "application/json" || json.NewDecoder(request.Body).Decode(new(any)) != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.MalformedJsonBody(`{"discount": 50%`)).Expect(ht.ExpectCode(400)).Test()
+	})
+}
+
+func TestDelay(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+
+		start := time.Now()
+		req := ht.Request("GET", "/", ht.Delay(30*time.Millisecond))
+		if time.Since(start) >= 30*time.Millisecond {
+			tb.Fatal("delay should not apply when building the request")
+		}
+
+		req.Expect().Test()
+		if time.Since(start) < 30*time.Millisecond {
+			tb.Fatal("delay was not applied when testing the request")
+		}
+	})
+}
+
+func TestExpectCanonicalJson(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body(`{"a":1.50,"b":[true,null],"c":"<&>"}`)).Expect(ht.ExpectCanonicalJson()).Test()
+	})
+
+	expectFailure(t, "response JSON is not canonical", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body(`{"b":1,"a":2}`)).Expect(ht.ExpectCanonicalJson()).Test()
+	})
+
+	expectFailure(t, "response JSON is not canonical", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body(`{"a": 1}`)).Expect(ht.ExpectCanonicalJson()).Test()
+	})
+}
+
+func TestExpectNegotiated(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if strings.Contains(request.Header.Get("Accept"), "xml") {
+			writer.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			_, _ = writer.Write([]byte("<ok/>"))
+		} else {
+			writer.Header().Set("Content-Type", "application/json")
+			_, _ = writer.Write([]byte(`{"ok":true}`))
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+
+		for accept, contentType := range map[string]string{"application/xml": "application/xml", "application/json": "application/json"} {
+			ht.Request("GET", "/").Expect(ht.ExpectNegotiated(accept, contentType, ht.ExpectCode(200))).Test()
+		}
+	})
+
+	expectFailure(t, "response is not of the expected media type", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectNegotiated("application/json", "application/xml")).Test()
+	})
+}
+
+func TestExpectJsonOnlyKeys(t *testing.T) {
+	body := `{"data":{"id":1,"name":"Scotty","email":"scotty@example.com"}}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonOnlyKeys("$.data", "email", "id", "name")).Test()
+	})
+
+	expectFailure(t, "missing\n[age]\nunexpected\n[email name]", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonOnlyKeys("$.data", "id", "age")).Test()
+	})
+}
+
+func TestExpectIdempotent(t *testing.T) {
+	seen := make(map[string]bool)
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		key := request.Header.Get("Idempotency-Key")
+		if seen[key] && key == "" {
+			writer.WriteHeader(http.StatusConflict)
+		}
+		seen[key] = true
+		_, _ = writer.Write([]byte(`{"id":1}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.IdempotencyKey("abc")).Expect(ht.ExpectIdempotent()).Test()
+	})
+
+	expectFailure(t, "response status differs when requested again", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/").Expect(ht.ExpectIdempotent()).Test()
+	})
+}
+
+func TestExpectReceived(t *testing.T) {
+	echo := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set(httptester.ReceivedPathHeader, request.URL.Path)
+		writer.Header().Set(httptester.ReceivedMethodHeader, request.Method)
+	})
+
+	// Rewrites /old/* to /new/* and method overrides.
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		request.URL.Path = strings.Replace(request.URL.Path, "/old/", "/new/", 1)
+		if override := request.Header.Get("X-HTTP-Method-Override"); override != "" {
+			request.Method = override
+		}
+		echo.ServeHTTP(writer, request)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/old/users", ht.Header("X-HTTP-Method-Override", "PUT")).
+			Expect(ht.ExpectReceivedPath("/new/users"), ht.ExpectReceivedMethod("PUT")).
+			Test()
+	})
+
+	expectFailure(t, "handler did not receive the expected request", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/old/users").Expect(ht.ExpectReceivedPath("/old/users")).Test()
+	})
+}
+
+func TestWithSummary(t *testing.T) {
+	tb := runRecordedTB(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler(), httptester.WithSummary())
+		ht.Request("GET", "/a").Expect().Test()
+		ht.Request("GET", "/b").Expect(ht.ExpectCode(500)).Test()
+	})
+
+	if len(tb.logs) != 1 || tb.logs[0] != "httptester: 2 requests tested, 1 passed, 1 failed\nfailed:\nGET /b" {
+		t.Fatalf("unexpected logs: %q", tb.logs)
+	}
+
+	// Requests sent by other assertions are also counted.
+	tb = runRecordedTB(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler(), httptester.WithSummary())
+		old := ht.Request("POST", "/old", ht.JsonBody(`{"id":1}`))
+		ht.Request("POST", "/new", ht.JsonBody(`{"id":1}`)).Expect(ht.ExpectEquivalentTo(old)).Test()
+	})
+
+	if len(tb.logs) != 1 || tb.logs[0] != "httptester: 2 requests tested, 2 passed, 0 failed" {
+		t.Fatalf("unexpected logs: %q", tb.logs)
+	}
+}
+
+func TestHeadMatchesGet(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		if request.Method == http.MethodHead && request.URL.Query().Has("broken") {
+			return
+		}
+		_, _ = writer.Write([]byte(`{"id":1}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestHeadMatchesGet("/users/1")
+	})
+
+	expectFailure(t, "Content-Length: HEAD \"\", GET \"8\"", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestHeadMatchesGet("/users/1?broken")
+	})
+}
+
+func TestExpectJsonExistsAll(t *testing.T) {
+	body := `{"id":1,"name":"Scotty","created_at":"2020-01-01","email":"","deleted_at":null}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonExistsAll("$.id", "$.name", "$.created_at")).Test()
+	})
+
+	expectFailure(t, "JSON paths are missing", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonExistsAll("$.id", "$.email", "$.deleted_at", "$.age")).Test()
+	})
+
+	failure := runRecorded(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonExistsAll("$.email", "$.deleted_at", "$.age")).Test()
+	})
+
+	for _, path := range []string{"$.email", "$.deleted_at", "$.age"} {
+		if !strings.Contains(failure, path+": ") {
+			t.Errorf("expected %s to be reported missing, got:\n%s", path, failure)
+		}
+	}
+}
+
+func TestContentLanguage(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		lang := "en"
+		if strings.HasPrefix(request.Header.Get("Accept-Language"), "fr") {
+			lang = "fr-CH"
+		}
+		writer.Header().Set("Content-Language", lang)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.AcceptLanguage("fr-CH, fr;q=0.9")).Expect(ht.ExpectContentLanguage("fr-ch")).Test()
+	})
+
+	expectFailure(t, "response is not in the expected language", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.AcceptLanguage("de")).Expect(ht.ExpectContentLanguage("fr-CH")).Test()
+	})
+}
+
+func TestExpectHeaderBytesUnder(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Set-Cookie", "session="+strings.Repeat("x", 4096))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectHeaderBytesUnder(8192)).Test()
+	})
+
+	expectFailure(t, "response headers are too large", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectHeaderBytesUnder(4096)).Test()
+	})
+}
+
+func TestExpectJsonInt(t *testing.T) {
+	body := `{"id":9007199254740993,"count":3,"total":1e3,"ratio":1.5,"name":"Scotty"}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonInt("$.count"), ht.ExpectJsonIntEquals("$.total", 1000), ht.ExpectJsonIntEquals("$.id", 9007199254740993)).
+			Test()
+	})
+
+	expectFailure(t, "value is not an int64", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonInt("$.ratio")).Test()
+	})
+
+	expectFailure(t, "value is not a number", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonInt("$.name")).Test()
+	})
+
+	expectFailure(t, "json path: $.id", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonIntEquals("$.id", 9007199254740992)).Test()
+	})
+}
+
+func TestExpectPerVersion(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Header.Get("API-Version") {
+		case "2":
+			_, _ = writer.Write([]byte(`{"fullName":"Montgomery Scott"}`))
+		default:
+			_, _ = writer.Write([]byte(`{"name":"Scotty"}`))
+		}
+	})
+
+	cases := map[string][]httptester.ResponseOption{}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		cases["1"] = []httptester.ResponseOption{ht.ExpectJsonExists("$.name")}
+		cases["2"] = []httptester.ResponseOption{ht.ExpectJsonExists("$.fullName"), ht.ExpectJsonNotExists("$.name")}
+		ht.Request("GET", "/users/1").Expect(ht.ExpectPerVersion("API-Version", cases)).Test()
+	})
+
+	expectFailure(t, "API-Version: 2", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		cases["1"] = []httptester.ResponseOption{ht.ExpectJsonExists("$.name")}
+		cases["2"] = []httptester.ResponseOption{ht.ExpectJsonExists("$.name")}
+		ht.Request("GET", "/users/1").Expect(ht.ExpectPerVersion("API-Version", cases)).Test()
+	})
+}
+
+func TestTrustedProxyChain(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		out, _ := json.Marshal(map[string]string{
+			"xff":       request.Header.Get("X-Forwarded-For"),
+			"forwarded": request.Header.Get("Forwarded"),
+		})
+		_, _ = writer.Write(out)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.TrustedProxyChain("203.0.113.7", "2001:db8::1", "10.0.0.1")).
+			Expect(
+				ht.ExpectJsonMatchStr("$.xff", "203.0.113.7, 2001:db8::1, 10.0.0.1"),
+				ht.ExpectJsonMatchStr("$.forwarded", `for=203.0.113.7, for="[2001:db8::1]", for=10.0.0.1`),
+			).
+			Test()
+	})
+}
+
+func TestExpectJsonEqualsApprox(t *testing.T) {
+	body := `{"name":"Cloud City","location":{"lat":51.50740001,"lng":-0.1278},"tags":["a"]}`
+
+	expected := map[string]any{
+		"location": map[string]any{"lng": -0.1278, "lat": 51.5074},
+		"name":     "Cloud City",
+		"tags":     []string{"a"},
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonEqualsApprox(expected, 0.0001)).Test()
+	})
+
+	expectFailure(t, "$.location.lat: expected 51.5074, actual 51.50740001", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonEqualsApprox(expected, 0)).Test()
+	})
+}
+
+func TestIdempotentDelete(t *testing.T) {
+	newHandler := func() http.Handler {
+		deleted := false
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if deleted && !request.URL.Query().Has("always") {
+				writer.WriteHeader(http.StatusNotFound)
+				return
+			}
+			deleted = true
+			writer.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, newHandler())
+		ht.TestIdempotentDelete("/users/1", http.StatusNotFound)
+	})
+
+	expectFailure(t, "second DELETE", func(tb httptester.TestingTB) {
+		ht := newTester(tb, newHandler())
+		ht.TestIdempotentDelete("/users/1?always", http.StatusNotFound)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, newHandler())
+		ht.TestIdempotentDelete("/users/1?always", http.StatusNoContent)
+	})
+}
+
+func TestExpectDecodesWith(t *testing.T) {
+	var out struct {
+		Name string `json:"name"`
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`{"name":"Scotty"}`)).Expect(ht.ExpectDecodesWith(json.Unmarshal, &out)).Test()
+	})
+
+	if out.Name != "Scotty" {
+		t.Fatalf("expected target to be populated, got %+v", out)
+	}
+
+	expectFailure(t, "failed to decode response body", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.Body("not json")).Expect(ht.ExpectDecodesWith(json.Unmarshal, &out)).Test()
+	})
+}
+
+func TestFailOnServerError(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/broken" {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.FailOnServerError()
+		ht.Request("GET", "/").Expect().Test()
+	})
+
+	expectFailure(t, "server error", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.FailOnServerError()
+		ht.Request("GET", "/broken").Expect(ht.ExpectBodyContains("")).Test()
+	})
+}
+
+func TestExpectAllow(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Allow", "GET, HEAD,OPTIONS")
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("OPTIONS", "/").Expect(ht.ExpectAllow("OPTIONS", "GET", "HEAD")).Test()
+	})
+
+	expectFailure(t, "missing\n[POST]\nunexpected\n[HEAD OPTIONS]", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("OPTIONS", "/").Expect(ht.ExpectAllow("GET", "POST")).Test()
+	})
+}
+
+func TestCaptureHeaders(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-B", "2")
+		writer.Header().Set("X-A", "1")
+		writer.Header().Set("Etag", `"abc"`)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		captures := ht.Request("GET", "/").Expect(ht.CaptureHeaders("headers")).Test()
+
+		if expected := "Content-Length: 0\r\nX-A: 1\r\nX-B: 2\r\n"; captures["headers"] != expected {
+			t.Errorf("expected headers %q, got %q", expected, captures["headers"])
+		}
+	})
+}
+
+func TestFormBody(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.PostFormValue("user")))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/login", ht.FormBody(url.Values{"user": {"bob"}})).Expect(ht.ExpectBodyContains("bob")).Test()
+	})
+
+	expectFailure(t, "FormBody() cannot be combined with a multipart form", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/login", ht.MultipartFormField("a", []byte("b")), ht.FormBody(url.Values{"user": {"bob"}}))
+	})
+
+	expectFailure(t, "a multipart form cannot be combined with FormBody()", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/login", ht.FormBody(url.Values{"user": {"bob"}}), ht.MultipartFormField("a", []byte("b")))
+	})
+}
+
+func TestRawBody(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.StringBody("100% literal %s")).Expect(ht.ExpectBodyContains("100% literal %s")).Test()
+		ht.Request("POST", "/", ht.RawBody([]byte{0x0a, 0x03, 'f', 'o', 'o'}), ht.Header("Content-Type", "application/x-protobuf")).
+			Expect(ht.ExpectContentType("application/x-protobuf"), ht.ExpectBodyContains("\n\x03foo")).
+			Test()
+	})
+}
+
+func TestCookie(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.Header.Get("Cookie")))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.Cookie(&http.Cookie{Name: "session", Value: "abc"}), ht.CookieKV("theme", "dark")).
+			Expect(ht.ExpectBodyContains("session=abc; theme=dark")).
+			Test()
+	})
+}
+
+func TestExpectDefaultContentType(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if _, hasAccept := request.Header["Accept"]; hasAccept {
+			writer.Header().Set("Content-Type", "application/xml")
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.Accept("application/xml")).Expect(ht.ExpectDefaultContentType("application/json")).Test()
+	})
+
+	expectFailure(t, "response is not of the expected media type", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectDefaultContentType("text/csv")).Test()
+	})
+}
+
+func TestExpectRedacted(t *testing.T) {
+	body := `{"name":"Scotty","ssn":"***","password":null,"cards":[{"number":"***"},{"number":""}],"pin":"1234"}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectRedacted("$.ssn", "$.password", "$.cards[*].number", "$.secret")).
+			Test()
+	})
+
+	expectFailure(t, "response contains unredacted values\npaths\n[$.name $.pin]", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectRedacted("$.name", "$.ssn", "$.pin")).Test()
+	})
+}
+
+func TestExpectCookie(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.SetCookie(writer, &http.Cookie{Name: "session", Value: "abc"})
+		http.SetCookie(writer, &http.Cookie{Name: "theme", Value: "dark"})
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectCookie("session", "abc"), ht.ExpectCookieExists("theme")).Test()
+	})
+
+	expectFailure(t, "response cookie has an unexpected value", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectCookie("session", "xyz")).Test()
+	})
+
+	expectFailure(t, "response does not set cookie\ncookie\nsesion\npresent\n[session theme]", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectCookieExists("sesion")).Test()
+	})
+}
+
+func TestCaptureHeader(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Request-Id", "req-123")
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		if id := ht.Request("GET", "/").Expect(ht.CaptureHeader("id", "X-Request-Id")).Test()["id"]; id != "req-123" {
+			t.Errorf("unexpected capture: %s", id)
+		}
+	})
+
+	expectFailure(t, "response does not have header to capture\nheader\nX-Trace-Id\npresent\n[Content-Length Date X-Request-Id]", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.CaptureHeader("id", "X-Trace-Id")).Test()
+	})
+}
+
+func TestExpectP95Under(t *testing.T) {
+	requests := 0
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		if request.URL.Query().Has("slow") {
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectP95Under(10, time.Second)).Test()
+	})
+
+	if requests != 11 {
+		t.Fatalf("expected 11 requests, got %d", requests)
+	}
+
+	expectFailure(t, "response time p95 is too slow", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?slow").Expect(ht.ExpectP95Under(3, 10*time.Millisecond)).Test()
+	})
+}
+
+func TestExpectJsonEquals(t *testing.T) {
+	body := `{"id":1,"name":"Scotty","tags":["a","b"]}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonEquals(map[string]any{"tags": []string{"a", "b"}, "name": "Scotty", "id": 1})).
+			Test()
+	})
+
+	expectFailure(t, "$.id: expected 2, actual 1\n$.tags[1]: expected \"c\", actual \"b\"", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(ht.ExpectJsonEquals(map[string]any{"tags": []string{"a", "c"}, "name": "Scotty", "id": 2})).
+			Test()
+	})
+}
+
+func TestExpectHeader(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Cache-Control", "public, max-age=60")
+		writer.Header().Add("Vary", "Accept")
+		writer.Header().Add("Vary", "Accept-Encoding")
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").
+			Expect(ht.ExpectHeader("Vary", "Accept-Encoding"), ht.ExpectHeaderContains("cache-control", "max-age=60")).
+			Test()
+	})
+
+	expectFailure(t, "response header does not have the expected value\nheader\nVary\nexpected\nOrigin\nactual\n[Accept Accept-Encoding]", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectHeader("Vary", "Origin")).Test()
+	})
+
+	expectFailure(t, "response header does not contain the expected value", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectHeaderContains("Cache-Control", "no-store")).Test()
+	})
+}
+
+func TestExpectCodeInRange(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		code, _ := strconv.Atoi(request.URL.Query().Get("code"))
+		writer.WriteHeader(code)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?code=204").Expect(ht.ExpectSuccess()).Test()
+		ht.Request("GET", "/?code=409").Expect(ht.ExpectClientError()).Test()
+		ht.Request("GET", "/?code=503").Expect(ht.ExpectServerError()).Test()
+		ht.Request("GET", "/?code=301").Expect(ht.ExpectCodeInRange(300, 399)).Test()
+	})
+
+	expectFailure(t, "response code is out of range\nexpected\n200-299\nactual\n404 Not Found", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?code=404").Expect(ht.ExpectSuccess()).Test()
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-request.Context().Done():
+		}
+	})
+
+	expectFailure(t, "request deadline exceeded: no response within 10ms", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.Timeout(10*time.Millisecond)).Expect().Test()
+	})
+
+	expectFailure(t, "request deadline exceeded", func(tb httptester.TestingTB) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.Context(ctx)).Expect().Test()
+	})
+}
+
+func TestWithClient(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/old" {
+			http.Redirect(writer, request, "/new", http.StatusMovedPermanently)
+		}
+	})
+
+	noRedirects := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler, httptester.WithClient(noRedirects))
+		ht.Request("GET", "/old").Expect(ht.ExpectCode(301), ht.ExpectHeader("Location", "/new")).Test()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler, httptester.WithClient(nil))
+		ht.Request("GET", "/old").Expect(ht.ExpectCode(200)).Test()
+	})
+
+	// Each tester given the option uses its own server's client.
+	defaultClient := httptester.WithClient(nil)
+	expectPass(t, func(tb httptester.TestingTB) {
+		for i := 0; i < 2; i++ {
+			srv := httptest.NewTLSServer(handler)
+			tb.Cleanup(srv.Close)
+
+			ht := httptester.New(tb, srv, defaultClient)
+			ht.Request("GET", "/new").Expect(ht.ExpectCode(200)).Test()
+		}
+	})
+}
+
+func TestNoRedirect(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/old" {
+			http.Redirect(writer, request, "/new", http.StatusFound)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/old", ht.NoRedirect()).Expect(ht.ExpectCode(302), ht.ExpectHeader("Location", "/new")).Test()
+		ht.Request("GET", "/old").Expect(ht.ExpectCode(200)).Test()
+	})
+}
+
+func TestExpectBodyMatches(t *testing.T) {
+	body := `<input name="csrf" value="f00d">`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.StringBody(body)).
+			Expect(ht.ExpectBodyMatches(`value="[0-9a-f]+"`), ht.ExpectBodyNotMatches(`<script`)).
+			Test()
+	})
+
+	expectFailure(t, "body does not match pattern", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.StringBody(body)).Expect(ht.ExpectBodyMatches(`^\d+$`)).Test()
+	})
+
+	expectFailure(t, "body unexpectedly matches pattern\npattern\ncsrf\nmatch\ncsrf", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.StringBody(body)).Expect(ht.ExpectBodyNotMatches(`csrf`)).Test()
+	})
+
+	expectFailure(t, "invalid pattern", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.ExpectBodyMatches(`(`)
+	})
+}
+
+func TestCaptureBodyRegex(t *testing.T) {
+	body := `<input name="csrf" value="f00d">`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		captures := ht.Request("POST", "/", ht.StringBody(body)).
+			Expect(ht.CaptureBodyRegex("csrf", `name="csrf" value="([^"]+)"`), ht.CaptureBodyRegex("tag", `<\w+`)).
+			Test()
+
+		if captures["csrf"] != "f00d" || captures["tag"] != "<input" {
+			t.Errorf("unexpected captures: %v", captures)
+		}
+	})
+
+	expectFailure(t, "body does not match pattern to capture", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.StringBody(body)).Expect(ht.CaptureBodyRegex("id", `id="(\d+)"`)).Test()
+	})
+}
+
+func TestCaptureJsonValue(t *testing.T) {
+	body := `{"count":42,"active":true,"tags":["a"],"name":"Scotty"}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		captures, values := ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(
+				ht.CaptureJson("name", "$.name"),
+				ht.CaptureJsonValue("count", "$.count"),
+				ht.CaptureJsonValue("active", "$.active"),
+				ht.CaptureJsonValue("tags", "$.tags"),
+			).
+			TestValues()
+
+		if captures["name"] != "Scotty" {
+			t.Errorf("unexpected captures: %v", captures)
+		}
+
+		if values["count"] != 42.0 || values["active"] != true || fmt.Sprint(values["tags"]) != "[a]" {
+			t.Errorf("unexpected values: %v", values)
+		}
+	})
+}
+
+func TestExpectJsonLen(t *testing.T) {
+	body := `{"items":[1,2,3],"meta":{"page":1},"name":"Scotty"}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonLen("$.items", 3), ht.ExpectJsonLen("$.meta", 1)).Test()
+	})
+
+	expectFailure(t, "JSON value does not have the expected length", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonLen("$.items", 2)).Test()
+	})
+
+	expectFailure(t, "value is not an array or object, so has no length", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonLen("$.name", 6)).Test()
+	})
+}
+
+func TestExpectJsonMatchNumbers(t *testing.T) {
+	body := `{"count":3,"ratio":0.5,"id":"3"}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).
+			Expect(
+				ht.ExpectJsonMatch("$.count", 3),
+				ht.ExpectJsonMatch("$.count", uint8(3)),
+				ht.ExpectJsonMatch("$.ratio", float32(0.5)),
+				ht.ExpectJsonMatches(map[string]any{"$.count": int64(3), "$.id": "3"}),
+			).
+			Test()
+	})
+
+	expectFailure(t, "values are not equal", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(body)).Expect(ht.ExpectJsonMatch("$.id", 3)).Test()
+	})
+}
+
+func TestJsonBodyInputs(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+
+		ht.Request("POST", "/", ht.JsonBody(strings.NewReader(`{"from":"reader"}`))).
+			Expect(ht.ExpectJsonMatchStr("$.from", "reader")).
+			Test()
+
+		ht.Request("POST", "/", ht.JsonBody(`{"from":"string"}`)).
+			Expect(ht.ExpectJsonMatchStr("$.from", "string")).
+			Test()
+
+		ht.Request("POST", "/", ht.JsonBody(map[string]string{"from": "value"})).
+			Expect(ht.ExpectJsonMatchStr("$.from", "value")).
+			Test()
+	})
+}
+
+func TestJsonBodyPercent(t *testing.T) {
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+
+		ht.Request("POST", "/", ht.JsonBody(`{"discount":"50%"}`)).
+			Expect(ht.ExpectJsonMatchStr("$.discount", "50%")).
+			Test()
+
+		ht.Request("POST", "/", ht.JsonBody(`{"discount":"%d%%"}`, 50)).
+			Expect(ht.ExpectJsonMatchStr("$.discount", "50%")).
+			Test()
+	})
+}
+
+func TestBasicAuth(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if user, pass, ok := request.BasicAuth(); !ok || user != "scotty" || pass != "beam me up" {
+			writer.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/", ht.BasicAuth("scotty", "beam me up")).Expect(ht.ExpectCode(200)).Test()
+		ht.Request("GET", "/", ht.BasicAuth("scotty", "wrong")).Expect(ht.ExpectCode(401)).Test()
+	})
+}
+
+func TestExpectFunc(t *testing.T) {
+	expectFailure(t, "unexpected length 5", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.StringBody("hello")).
+			Expect(ht.ExpectFunc(func(t httptester.TestingTB, response *http.Response, body string) {
+				if response.ContentLength != int64(len(body)) {
+					t.Fatal("content length does not match body")
+				}
+				if len(body) != 3 {
+					t.Fatal(fmt.Sprintf("unexpected length %d", len(body)))
+				}
+			})).
+			Test()
+	})
+}
+
+func TestTestResponse(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Location", "/jobs/1")
+		writer.WriteHeader(http.StatusAccepted)
+		_, _ = writer.Write([]byte(`{"id":"1"}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		result := ht.Request("POST", "/jobs").Expect(ht.CaptureJson("id", "$.id")).TestResponse()
+
+		if result.StatusCode != 202 || result.Header.Get("Location") != "/jobs/1" || result.Body != `{"id":"1"}` || result.Captures["id"] != "1" {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+}
+
+func TestRemoveHeader(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.Header.Get("Content-Type")))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.JsonBody(map[string]any{"a": 1}), ht.RemoveHeader("Content-Type")).
+			Expect(ht.ExpectBodyMatches(`^$`)).
+			Test()
+	})
+}
+
+func TestExpectJsonMatchRegex(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"id":"3f2c9a1e-7b4d-4c8a-9e21-5d6f0a8b7c3d"}`))
+	})
+
+	uuid := `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectJsonMatchRegex("$.id", uuid)).Test()
+	})
+
+	expectFailure(t, "JSON value does not match pattern", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectJsonMatchRegex("$.id", `^[0-9]+$`)).Test()
+	})
+}
+
+func TestExpectEmptyBody(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodDelete {
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		_, _ = writer.Write([]byte("leaked"))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("DELETE", "/").Expect(ht.ExpectEmptyBody()).Test()
+	})
+
+	expectFailure(t, "response body is not empty", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectEmptyBody()).Test()
+	})
+}
+
+func TestRequestName(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"id":"1"}`))
+	})
+
+	ht := newTester(t, handler)
+	captures := ht.Request("POST", "/users").Name("create user").Expect(ht.CaptureJson("id", "$.id")).Test()
+
+	if captures["id"] != "1" {
+		t.Errorf("unexpected captures: %v", captures)
+	}
+
+	captures = ht.Request("GET", "/users/1").Name("await user").Expect(ht.CaptureJson("id", "$.id")).TestEventually(time.Second, 10*time.Millisecond)
+
+	if captures["id"] != "1" {
+		t.Errorf("unexpected captures: %v", captures)
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		// A TestingTB without Run tests inline.
+		ht := httptester.New(struct{ httptester.TestingTB }{tb}, httptester.Server(tb, handler))
+		ht.Request("GET", "/").Name("inline").Expect(ht.ExpectCode(200)).Test()
+	})
+}
+
+func TestExpectFasterThan(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		result := ht.Request("GET", "/").Expect(ht.ExpectFasterThan(time.Second)).TestResponse()
+
+		if result.Duration <= 0 || result.Duration > time.Second {
+			t.Errorf("unexpected duration: %s", result.Duration)
+		}
+	})
+
+	expectFailure(t, "response was too slow", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/slow").Expect(ht.ExpectFasterThan(10 * time.Millisecond)).Test()
+	})
+}
+
+func TestPathParams(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.URL.EscapedPath()))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/users/{id}/posts/{postId}", ht.PathParams(map[string]string{"id": "a/b", "postId": "7"})).
+			Expect(ht.ExpectBodyContains("/users/a%2Fb/posts/7")).
+			Test()
+	})
+
+	expectFailure(t, "path has unresolved parameters", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/users/{id}/posts/{postId}", ht.PathParams(map[string]string{"id": "1"})).Expect().Test()
+	})
+}
+
+func TestExpectJsonNotMatch(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"user":{"name":"a","role":"member","age":30}}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").
+			Expect(ht.ExpectJsonNotMatch("$.user.role", "admin"), ht.ExpectJsonNotExists("$..password")).
+			Test()
+	})
+
+	expectFailure(t, "JSON value unexpectedly matches", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectJsonNotMatch("$.user.age", 30)).Test()
+	})
+
+	expectFailure(t, "did not expect JSON path to exist", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectJsonNotExists("$..name")).Test()
+	})
+}
+
+func TestMultipartForm(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		reader, err := request.MultipartReader()
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		parts := make([]string, 0)
+		for part, err := reader.NextPart(); err == nil; part, err = reader.NextPart() {
+			data, _ := io.ReadAll(part)
+			parts = append(parts, part.FormName()+"="+string(data))
+		}
+
+		_, _ = writer.Write([]byte(strings.Join(parts, ",")))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.MultipartForm(
+			map[string]string{"title": "Report", "author": "a"},
+			map[string]io.Reader{"report.txt": strings.NewReader("contents")},
+		)).Expect(ht.ExpectBodyContains("author=a,title=Report,report.txt=contents")).Test()
+	})
+}
+
+func TestBodyConflictsWithMultipart(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
+
+	expectFailure(t, "JsonBody() cannot be combined with a multipart form", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.MultipartFormField("a", []byte("b")), ht.JsonBody(map[string]any{"a": "b"}))
+	})
+
+	expectFailure(t, "a multipart form cannot be combined with XmlBody()", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("POST", "/", ht.XmlBody("<a/>"), ht.MultipartFormFile("f", "f.txt", strings.NewReader("data")))
+	})
+}
+
+func TestPrettyJsonResponseOutput(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"a":{"b":1}}`))
+	})
+
+	expectFailure(t, "{\n  \"a\": {\n    \"b\": 1\n  }\n}", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectCode(404)).Test()
+	})
+}
+
+func TestDecode(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/invalid" {
+			_, _ = writer.Write([]byte(`{"name":`))
+			return
+		}
+
+		_, _ = writer.Write([]byte(`{"name":"Scotty","age":30}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		exp := ht.Request("GET", "/").Expect(ht.ExpectCode(200))
+		decoded := httptester.Decode[user](exp)
+		exp.Test()
+
+		if decoded.Name != "Scotty" || decoded.Age != 30 {
+			t.Errorf("unexpected decoded value: %+v", decoded)
+		}
+	})
+
+	expectFailure(t, "failed to decode response body", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		exp := ht.Request("GET", "/invalid").Expect()
+		httptester.Decode[user](exp)
+		exp.Test()
+	})
+}
+
+func TestMethodShorthands(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.Method))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Get("/").Expect(ht.ExpectBodyContains("GET")).Test()
+		ht.Post("/").Expect(ht.ExpectBodyContains("POST")).Test()
+		ht.Put("/").Expect(ht.ExpectBodyContains("PUT")).Test()
+		ht.Patch("/").Expect(ht.ExpectBodyContains("PATCH")).Test()
+		ht.Delete("/").Expect(ht.ExpectBodyContains("DELETE")).Test()
+	})
+}
+
+func TestExpectRedirect(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/account" {
+			http.Redirect(writer, request, "/login", http.StatusFound)
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/account").Expect(ht.ExpectRedirect(http.StatusFound, "/login")).Test()
+	})
+
+	expectFailure(t, "response redirects to the wrong location", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/account").Expect(ht.ExpectRedirect(http.StatusFound, "/home")).Test()
+	})
+
+	expectFailure(t, "response is not the expected redirect", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/login").Expect(ht.ExpectRedirect(http.StatusFound, "/login")).Test()
+	})
+}
+
+func TestCaptureInto(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"id":42,"tags":["a","b"],"name":"widget","big":1234567890123456789}`))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+
+		var id int
+		var tags []string
+		var big int64
+		ht.Request("GET", "/").Expect(ht.CaptureInto(&id, "$.id"), ht.CaptureInto(&tags, "$.tags"), ht.CaptureInto(&big, "$.big")).Test()
+
+		if id != 42 || len(tags) != 2 || tags[1] != "b" || big != 1234567890123456789 {
+			t.Errorf("unexpected captures: %d %v %d", id, tags, big)
+		}
+	})
+
+	expectFailure(t, "cannot capture JSON value into target", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+
+		var id int
+		ht.Request("GET", "/").Expect(ht.CaptureInto(&id, "$.name")).Test()
+	})
+
+	expectFailure(t, "CaptureInto() requires a non-nil pointer", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.CaptureInto(0, "$.id")
+	})
+}
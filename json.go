@@ -3,11 +3,18 @@ package httptester
 import (
 	"bytes"
 	"context"
+	"encoding"
 	"encoding/json"
+	"fmt"
 	"github.com/PaesslerAG/gval"
 	"github.com/PaesslerAG/jsonpath"
 	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 // JsonContainsStr fatals the test if the provided JSON data does not contain a string value
@@ -54,26 +61,37 @@ func JsonContains(t TestingTB, data string, pathexpr string, extra ...any) any {
 func DataContains(t TestingTB, data any, pathexpr string, extra ...any) any {
 	t.Helper()
 
-	builder := gval.Full(jsonpath.PlaceholderExtension())
+	captured, err := lookupJsonPath(data, pathexpr)
+	if err != nil {
+		// JSON encode data for cleaner failure messages.
+		if asJson, jsonErr := json.MarshalIndent(data, "", "  "); jsonErr == nil {
+			data = string(asJson)
+		}
 
-	path, err := builder.NewEvaluable(pathexpr)
-	must(t, err, extra...)
+		args := []any{"failed to capture JSON path", pathexpr, "full data", data}
+		args = append(args, extra...)
+		fatal(t, err, args...)
+	}
 
-	captured, err := path(context.Background(), data)
+	return captured
+}
 
-	// JSON encode data for cleaner failure messages.
-	asJson, err := json.MarshalIndent(data, "", "  ")
+// lookupJsonPath resolves pathexpr against data, as per JSONPath, returning an
+// error if the expression is invalid or does not match anything.
+func lookupJsonPath(data any, pathexpr string) (any, error) {
+	builder := gval.Full(jsonpath.PlaceholderExtension())
+
+	path, err := builder.NewEvaluable(pathexpr)
 	if err != nil {
-		data = asJson
+		return nil, err
 	}
 
-	must(t, err, "failed to capture JSON path", pathexpr, "full data", data)
-
-	return captured
+	return path(context.Background(), data)
 }
 
 // JsonNotContains is the inversion of JsonContains. This fatals the test if the provided
-// JSON path expression matches anything in data.
+// JSON path expression matches anything in data. A path which resolves to an empty
+// list, e.g. a recursive descent which finds nothing, does not match.
 func JsonNotContains(t TestingTB, data string, pathexpr string, extra ...any) any {
 	t.Helper()
 
@@ -85,17 +103,10 @@ func JsonNotContains(t TestingTB, data string, pathexpr string, extra ...any) an
 	body := MustParseJson[any](t, strings.NewReader(data), extra...)
 
 	captured, err := path(context.Background(), body)
-	if err == nil {
-		fatal(
-			t,
-			"did not expect JSON path to exist",
-			"path",
-			pathexpr,
-			"matched",
-			captured,
-			"full data",
-			data,
-		)
+	if list, isList := captured.([]any); err == nil && (!isList || len(list) > 0) {
+		args := []any{"path", pathexpr, "matched", captured, "full data", data}
+		args = append(args, extra...)
+		fatal(t, "did not expect JSON path to exist", args...)
 	}
 
 	return captured
@@ -119,3 +130,487 @@ func MustParseJson[T any](t TestingTB, in io.Reader, extra ...any) T {
 
 	return out
 }
+
+// jsonPathSegment is a single step in a simple JSON path, as understood by
+// removeJsonPath and lookupSimpleJsonPath.
+type jsonPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseSimpleJsonPath parses a restricted form of JSONPath consisting only of
+// child steps: $.name, $['name'], $[0], $[*] and $.*. This is enough to address
+// values that need to be manipulated (rather than just read) in parsed JSON.
+func parseSimpleJsonPath(pathexpr string) ([]jsonPathSegment, error) {
+	if !strings.HasPrefix(pathexpr, "$") {
+		return nil, fmt.Errorf("json path %q must start with $", pathexpr)
+	}
+
+	segments := make([]jsonPathSegment, 0)
+	rest := pathexpr[1:]
+
+	for len(rest) > 0 {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("json path %q has an unclosed [", pathexpr)
+			}
+
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if inner == "*" {
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			} else if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, jsonPathSegment{key: inner[1 : len(inner)-1]})
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 {
+				segments = append(segments, jsonPathSegment{index: index, isIndex: true})
+			} else {
+				return nil, fmt.Errorf("json path %q has an unsupported selector [%s]", pathexpr, inner)
+			}
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+
+			name := rest[:end]
+			rest = rest[end:]
+
+			if name == "" {
+				return nil, fmt.Errorf("json path %q has an empty name", pathexpr)
+			}
+
+			if name == "*" {
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			} else {
+				segments = append(segments, jsonPathSegment{key: name})
+			}
+		default:
+			return nil, fmt.Errorf("json path %q is not supported here", pathexpr)
+		}
+	}
+
+	return segments, nil
+}
+
+// removeJsonPath removes all values in data addressed by segments, returning
+// the modified data. data should be decoded JSON, as per json.Unmarshal into any.
+func removeJsonPath(data any, segments []jsonPathSegment) any {
+	if len(segments) == 0 {
+		return data
+	}
+
+	seg, last := segments[0], len(segments) == 1
+
+	switch v := data.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if !seg.wildcard && (seg.isIndex || seg.key != key) {
+				continue
+			}
+
+			if last {
+				delete(v, key)
+			} else {
+				v[key] = removeJsonPath(child, segments[1:])
+			}
+		}
+	case []any:
+		if last {
+			if seg.wildcard {
+				return []any{}
+			}
+
+			if seg.isIndex && seg.index < len(v) {
+				return append(v[:seg.index:seg.index], v[seg.index+1:]...)
+			}
+
+			return v
+		}
+
+		for i := range v {
+			if seg.wildcard || (seg.isIndex && seg.index == i) {
+				v[i] = removeJsonPath(v[i], segments[1:])
+			}
+		}
+	}
+
+	return data
+}
+
+// lookupSimpleJsonPath resolves segments against data, reporting found as false
+// if any step names a key which is absent from its object. Stepping into a
+// value of the wrong type, an out of range index or a wildcard is an error.
+func lookupSimpleJsonPath(data any, segments []jsonPathSegment) (value any, found bool, err error) {
+	for i, seg := range segments {
+		if seg.wildcard {
+			return nil, false, fmt.Errorf("step %d is a wildcard, which does not address a single value", i+1)
+		}
+
+		switch v := data.(type) {
+		case map[string]any:
+			if seg.isIndex {
+				return nil, false, fmt.Errorf("step %d is index %d, but the value is an object", i+1, seg.index)
+			}
+
+			if data, found = v[seg.key]; !found {
+				return nil, false, nil
+			}
+		case []any:
+			if !seg.isIndex {
+				return nil, false, fmt.Errorf("step %d is key %q, but the value is an array", i+1, seg.key)
+			}
+
+			if seg.index >= len(v) {
+				return nil, false, fmt.Errorf("step %d is index %d, but the array has %d elements", i+1, seg.index, len(v))
+			}
+
+			data = v[seg.index]
+		default:
+			return nil, false, fmt.Errorf("step %d cannot be applied to %s", i+1, compactJson(data))
+		}
+	}
+
+	return data, true, nil
+}
+
+// scrubJson removes all values at each of paths from data, fataling the test if
+// any path cannot be understood. See parseSimpleJsonPath for supported paths.
+func scrubJson(t TestingTB, data any, paths []string, extra ...any) any {
+	t.Helper()
+
+	for _, pathexpr := range paths {
+		segments, err := parseSimpleJsonPath(pathexpr)
+		must(t, err, extra...)
+
+		data = removeJsonPath(data, segments)
+	}
+
+	return data
+}
+
+// jsonDiff describes where expected and actual differ, with one line per
+// differing path. Both should be decoded JSON, as per json.Unmarshal into any.
+// Returns nothing if they are equal.
+func jsonDiff(path string, expected, actual any) []string {
+	return jsonDiffWithin(path, expected, actual, 0)
+}
+
+// jsonDiffWithin is like jsonDiff, but numbers are considered equal if they
+// differ by no more than tolerance.
+func jsonDiffWithin(path string, expected, actual any, tolerance float64) []string {
+	diff := make([]string, 0)
+
+	switch exp := expected.(type) {
+	case map[string]any:
+		act, ok := actual.(map[string]any)
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(exp)+len(act))
+		for key := range exp {
+			keys = append(keys, key)
+		}
+		for key := range act {
+			if _, inExp := exp[key]; !inExp {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			expVal, inExp := exp[key]
+			actVal, inAct := act[key]
+			childPath := jsonChildPath(path, key)
+
+			switch {
+			case !inAct:
+				diff = append(diff, fmt.Sprintf("%s: missing, expected %s", childPath, compactJson(expVal)))
+			case !inExp:
+				diff = append(diff, fmt.Sprintf("%s: unexpected %s", childPath, compactJson(actVal)))
+			default:
+				diff = append(diff, jsonDiffWithin(childPath, expVal, actVal, tolerance)...)
+			}
+		}
+
+		return diff
+	case []any:
+		act, ok := actual.([]any)
+		if !ok {
+			break
+		}
+
+		if len(exp) != len(act) {
+			diff = append(diff, fmt.Sprintf("%s: expected %d elements, actual %d", path, len(exp), len(act)))
+		}
+
+		for i := 0; i < len(exp) && i < len(act); i++ {
+			diff = append(diff, jsonDiffWithin(fmt.Sprintf("%s[%d]", path, i), exp[i], act[i], tolerance)...)
+		}
+
+		return diff
+	case float64:
+		if act, ok := actual.(float64); ok && math.Abs(exp-act) <= tolerance {
+			return diff
+		}
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		diff = append(diff, fmt.Sprintf("%s: expected %s, actual %s", path, compactJson(expected), compactJson(actual)))
+	}
+
+	return diff
+}
+
+// jsonChildPath builds a JSON path for key under parent.
+func jsonChildPath(parent, key string) string {
+	for _, r := range key {
+		if !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return fmt.Sprintf("%s[%s]", parent, strconv.Quote(key))
+		}
+	}
+
+	return parent + "." + key
+}
+
+// compactJson renders val as JSON for use in failure messages, falling back
+// to Go formatting if it cannot be encoded.
+func compactJson(val any) string {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return format(val)
+	}
+
+	return string(b)
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// jsonShapeDiff describes where val, which is decoded JSON, does not have the
+// shape that encoding/json would produce for a value of type typ. Only types
+// are compared, not values. Returns nothing if val has the expected shape.
+func jsonShapeDiff(path string, typ reflect.Type, val any) []string {
+	if val == nil {
+		switch typ.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+			return nil
+		}
+
+		return []string{fmt.Sprintf("%s: expected %s, actual null", path, typ)}
+	}
+
+	if typ.Kind() == reflect.Pointer {
+		return jsonShapeDiff(path, typ.Elem(), val)
+	}
+
+	// Types with custom JSON decoding could accept anything. Those which can also
+	// be decoded from text, such as time.Time, are assumed to be strings.
+	textual := reflect.PointerTo(typ).Implements(textUnmarshalerType)
+	if !textual && reflect.PointerTo(typ).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+
+	expected := ""
+
+	switch {
+	case textual:
+		expected = "string"
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		// []byte is encoded as a base64 string.
+		expected = "string"
+	default:
+		switch typ.Kind() {
+		case reflect.Interface:
+			return nil
+		case reflect.Bool:
+			expected = "boolean"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			expected = "number"
+		case reflect.String:
+			expected = "string"
+		case reflect.Slice, reflect.Array:
+			expected = "array"
+		case reflect.Map, reflect.Struct:
+			expected = "object"
+		}
+	}
+
+	if actual := jsonTypeName(val); actual != expected {
+		return []string{fmt.Sprintf("%s: expected %s (%s), actual %s", path, expected, typ, actual)}
+	}
+
+	diff := make([]string, 0)
+
+	switch v := val.(type) {
+	case []any:
+		for i, element := range v {
+			diff = append(diff, jsonShapeDiff(fmt.Sprintf("%s[%d]", path, i), typ.Elem(), element)...)
+		}
+	case map[string]any:
+		if typ.Kind() == reflect.Map {
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				diff = append(diff, jsonShapeDiff(jsonChildPath(path, key), typ.Elem(), v[key])...)
+			}
+
+			break
+		}
+
+		for _, field := range jsonFields(typ) {
+			fieldVal, exists := v[field.name]
+
+			switch {
+			case !exists && !field.omitempty:
+				diff = append(diff, fmt.Sprintf("%s: missing, expected %s", jsonChildPath(path, field.name), field.typ))
+			case exists && field.asString:
+				if jsonTypeName(fieldVal) != "string" {
+					diff = append(diff, fmt.Sprintf("%s: expected string (%s), actual %s", jsonChildPath(path, field.name), field.typ, jsonTypeName(fieldVal)))
+				}
+			case exists:
+				diff = append(diff, jsonShapeDiff(jsonChildPath(path, field.name), field.typ, fieldVal)...)
+			}
+		}
+	}
+
+	return diff
+}
+
+// jsonField describes a struct field as encoded by encoding/json.
+type jsonField struct {
+	name      string
+	typ       reflect.Type
+	omitempty bool
+	asString  bool
+}
+
+// jsonFields lists the fields encoding/json would encode for struct type typ,
+// including those promoted from embedded structs.
+func jsonFields(typ reflect.Type) []jsonField {
+	fields := make([]jsonField, 0)
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(fieldType)...)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		optList := strings.Split(opts, ",")
+		fields = append(fields, jsonField{
+			name:      name,
+			typ:       field.Type,
+			omitempty: contains(optList, "omitempty"),
+			asString:  contains(optList, "string"),
+		})
+	}
+
+	return fields
+}
+
+// jsonTypeName names the JSON type of val, which is decoded JSON.
+func jsonTypeName(val any) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
+
+// normaliseNumber converts val to a float64 if it is of any numeric type, as
+// numbers are when decoded from JSON. Other values are returned as is.
+func normaliseNumber(val any) any {
+	v := reflect.ValueOf(val)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+
+	return val
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalJson re-encodes data in a canonical form: object keys sorted, no
+// insignificant whitespace and numbers preserved as written.
+func canonicalJson(data string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+
+	var parsed any
+	if err := decoder.Decode(&parsed); err != nil {
+		return "", err
+	}
+
+	out := &bytes.Buffer{}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(parsed); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
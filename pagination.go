@@ -0,0 +1,105 @@
+package httptester
+
+// Assertions against paginated endpoints.
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PaginationCursorParam is the query parameter used by TestPaginationDrains to
+// request the next page, given a cursor.
+var PaginationCursorParam = "cursor"
+
+// TestPaginationDrains immediately follows a cursor-paginated endpoint from
+// firstPath until it runs out of pages. Each page must be a successful response
+// with a JSON body, which contains the next page's cursor at JSON path
+// nextField. Pagination ends when this is absent, null or empty; any other
+// failure to evaluate nextField, e.g. a step into a non-object, fails the test.
+// nextField must be a simple path, as per parseSimpleJsonPath, without
+// wildcards.
+//
+// A cursor which begins with "/" is requested as a path; any other is sent as
+// the PaginationCursorParam query parameter of firstPath.
+//
+// Fails if more than maxPages are returned, or if a cursor is repeated, as
+// either suggests that pagination will never end. Failures report the page.
+func (h *HttpTester) TestPaginationDrains(firstPath string, nextField string, maxPages int) {
+	h.t.Helper()
+
+	segments, err := parseSimpleJsonPath(nextField)
+	if err != nil {
+		fatal(h.t, "failed to read the next page's cursor", "path", nextField, "error", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	path := firstPath
+
+	for page := 1; ; page++ {
+		extra := []any{"page", page, "path", path}
+
+		if page > maxPages {
+			fatal(h.t, fmt.Sprintf("pagination did not end within %d pages", maxPages), extra...)
+			return
+		}
+
+		req := h.Request(http.MethodGet, path)
+		req.done = true
+		req.finalise(extra...)
+
+		response, body, _ := req.send(h.t, req.build(), false, nil, extra...)
+
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			fatal(h.t, "pagination request failed", append([]any{"status", response.Status}, extra...)...)
+			return
+		}
+
+		data := MustParseJson[any](h.t, strings.NewReader(body), extra...)
+		req.passed = true
+
+		next, found, err := lookupSimpleJsonPath(data, segments)
+		if err != nil {
+			fatal(h.t, "failed to read the next page's cursor", append([]any{"path", nextField, "error", err}, extra...)...)
+			return
+		}
+
+		if !found || next == nil || next == "" {
+			return
+		}
+
+		cursor, isStr := next.(string)
+		if !isStr {
+			cursor = compactJson(next)
+		}
+
+		if seen[cursor] {
+			fatal(h.t, "pagination repeated a cursor", append([]any{"cursor", cursor}, extra...)...)
+			return
+		}
+		seen[cursor] = true
+
+		path = h.nextPagePath(firstPath, cursor, extra...)
+	}
+}
+
+// nextPagePath returns the path of the page after firstPath identified by
+// cursor.
+func (h *HttpTester) nextPagePath(firstPath, cursor string, extra ...any) string {
+	h.t.Helper()
+
+	if strings.HasPrefix(cursor, "/") {
+		return cursor
+	}
+
+	u, err := url.Parse(firstPath)
+	must(h.t, err, extra...)
+
+	query := u.Query()
+	query.Set(PaginationCursorParam, cursor)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,58 @@
+package httptester_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestPaginationDrains(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		cursor, _ := strconv.Atoi(request.URL.Query().Get("cursor"))
+
+		next := any(nil)
+		switch {
+		case request.URL.Path == "/loop":
+			next = "1"
+		case request.URL.Path == "/links":
+			if cursor < 2 {
+				next = fmt.Sprintf("/links?cursor=%d", cursor+1)
+			}
+		case cursor < 3:
+			next = strconv.Itoa(cursor + 1)
+		}
+
+		out, _ := json.Marshal(map[string]any{"items": []int{cursor}, "next": next})
+		_, _ = writer.Write(out)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestPaginationDrains("/items", "$.next", 4)
+		ht.TestPaginationDrains("/links", "$.next", 3)
+		ht.TestPaginationDrains("/items", "$.meta.next", 1)
+	})
+
+	expectFailure(t, "pagination did not end within 3 pages", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestPaginationDrains("/items", "$.next", 3)
+	})
+
+	expectFailure(t, "pagination repeated a cursor", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestPaginationDrains("/loop", "$.next", 10)
+	})
+
+	expectFailure(t, "failed to read the next page's cursor", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestPaginationDrains("/items", "$next", 4)
+	})
+
+	expectFailure(t, "failed to read the next page's cursor", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.TestPaginationDrains("/items", "$.items.next", 4)
+	})
+}
@@ -0,0 +1,65 @@
+package httptester
+
+// Assertions against RFC 7807 problem details error responses.
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ExpectProblemJson asserts that the response is an RFC 7807 problem details
+// error, with the given status code and a body of media type
+// application/problem+json. The body's type member must be problemType, which
+// defaults to "about:blank" if omitted. Its status member, if present, must
+// match the response's status code, and its title member, if present, must be
+// a string. All inconsistent members are reported together.
+func (h *HttpTester) ExpectProblemJson(status int, problemType string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			equals(t, status, response.StatusCode, extra...)
+
+			contentType := response.Header.Get("Content-Type")
+			if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/problem+json" {
+				args := []any{"Content-Type", contentType}
+				args = append(args, extra...)
+				fatal(t, "response is not application/problem+json", args...)
+			}
+
+			problem, isObject := MustParseJson[any](t, strings.NewReader(body), extra...).(map[string]any)
+			if !isObject {
+				fatal(t, "problem details must be a JSON object", extra...)
+				return
+			}
+
+			inconsistent := make([]string, 0)
+
+			actualType, hasType := problem["type"]
+			if !hasType {
+				actualType = "about:blank"
+			}
+			if actualType != problemType {
+				inconsistent = append(inconsistent, fmt.Sprintf("type: expected %q, actual %s", problemType, compactJson(actualType)))
+			}
+
+			if actualStatus, hasStatus := problem["status"]; hasStatus && actualStatus != float64(response.StatusCode) {
+				inconsistent = append(inconsistent, fmt.Sprintf("status: response is %d, body has %s", response.StatusCode, compactJson(actualStatus)))
+			}
+
+			if title, hasTitle := problem["title"]; hasTitle {
+				if _, isStr := title.(string); !isStr {
+					inconsistent = append(inconsistent, fmt.Sprintf("title: expected a string, actual %s", compactJson(title)))
+				}
+			}
+
+			if len(inconsistent) > 0 {
+				args := []any{strings.Join(inconsistent, "\n")}
+				args = append(args, extra...)
+				fatal(t, "problem details are inconsistent", args...)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"testing"
+)
+
+func TestExpectProblemJson(t *testing.T) {
+	problems := map[string]string{
+		"/credit":   `{"type":"https://example.com/out-of-credit","status":403,"title":"Out of credit"}`,
+		"/blank":    `{}`,
+		"/mismatch": `{"status":400}`,
+	}
+
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/problem+json")
+		writer.WriteHeader(http.StatusForbidden)
+		_, _ = writer.Write([]byte(problems[request.URL.Path]))
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/credit").Expect(ht.ExpectProblemJson(403, "https://example.com/out-of-credit")).Test()
+		ht.Request("GET", "/blank").Expect(ht.ExpectProblemJson(403, "about:blank")).Test()
+	})
+
+	expectFailure(t, "status: response is 403, body has 400", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/mismatch").Expect(ht.ExpectProblemJson(403, "about:blank")).Test()
+	})
+
+	expectFailure(t, "response is not application/problem+json", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("GET", "/").Expect(ht.ExpectProblemJson(200, "about:blank")).Test()
+	})
+}
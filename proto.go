@@ -0,0 +1,51 @@
+package httptester
+
+// Assertions against protobuf messages encoded as JSON, as served by
+// gRPC-gateway and similar.
+
+import (
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"strings"
+)
+
+// ExpectProtoJson asserts that the HTTP response has a body which decodes, via
+// protojson, to a message equal to expected, as per proto.Equal. This follows
+// protobuf's JSON mapping rather than encoding/json's, e.g. for default values
+// and well-known types.
+func (h *HttpTester) ExpectProtoJson(expected proto.Message) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			actual := expected.ProtoReflect().New().Interface()
+
+			err := protojson.Unmarshal([]byte(body), actual)
+			must(t, err, append([]any{"failed to decode response body as", expected.ProtoReflect().Descriptor().FullName()}, extra...)...)
+
+			if proto.Equal(expected, actual) {
+				return
+			}
+
+			args := []any{"message", expected.ProtoReflect().Descriptor().FullName()}
+
+			// Describe the difference via each message's JSON form.
+			expectedJson, expErr := protojson.Marshal(expected)
+			actualJson, actErr := protojson.Marshal(actual)
+			if expErr == nil && actErr == nil {
+				diff := jsonDiff(
+					"$",
+					MustParseJson[any](t, strings.NewReader(string(expectedJson)), extra...),
+					MustParseJson[any](t, strings.NewReader(string(actualJson)), extra...),
+				)
+				args = append(args, "diff", strings.Join(diff, "\n"))
+			} else {
+				args = append(args, "expected", expected, "actual", actual)
+			}
+
+			args = append(args, extra...)
+			fatal(t, "response does not equal expected proto message", args...)
+		})
+	}
+}
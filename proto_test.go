@@ -0,0 +1,31 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+	"time"
+)
+
+func TestExpectProtoJson(t *testing.T) {
+	expected, err := structpb.NewStruct(map[string]any{"name": "Scotty", "tags": []any{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`{"tags":["a"],"name":"Scotty"}`)).Expect(ht.ExpectProtoJson(expected)).Test()
+	})
+
+	expectFailure(t, `$.name: expected "Scotty", actual "Kirk"`, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`{"tags":["a"],"name":"Kirk"}`)).Expect(ht.ExpectProtoJson(expected)).Test()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.JsonBody(`"1.5s"`)).Expect(ht.ExpectProtoJson(durationpb.New(1500 * time.Millisecond))).Test()
+	})
+}
@@ -0,0 +1,90 @@
+package httptester
+
+// Assertions against rate limiting behaviour.
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// RateLimitScheme names the response headers a server uses to report its rate
+// limits.
+type RateLimitScheme struct {
+	Limit     string
+	Remaining string
+	Reset     string
+}
+
+var (
+	// RateLimitXHeaders is the widely used X-RateLimit-* header scheme.
+	RateLimitXHeaders = RateLimitScheme{
+		Limit:     "X-RateLimit-Limit",
+		Remaining: "X-RateLimit-Remaining",
+		Reset:     "X-RateLimit-Reset",
+	}
+
+	// RateLimitDraftHeaders is the IETF draft RateLimit-* header scheme.
+	RateLimitDraftHeaders = RateLimitScheme{
+		Limit:     "RateLimit-Limit",
+		Remaining: "RateLimit-Remaining",
+		Reset:     "RateLimit-Reset",
+	}
+)
+
+// ExpectRateLimitHeaders asserts that the response reports its rate limit via
+// the RateLimitXHeaders scheme, with each header present and numeric.
+func (h *HttpTester) ExpectRateLimitHeaders() ResponseOption {
+	return h.ExpectRateLimitHeadersScheme(RateLimitXHeaders)
+}
+
+// ExpectRateLimitHeadersScheme is like ExpectRateLimitHeaders, but for a
+// specific naming scheme, e.g. RateLimitDraftHeaders.
+func (h *HttpTester) ExpectRateLimitHeadersScheme(scheme RateLimitScheme) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			for _, name := range []string{scheme.Limit, scheme.Remaining, scheme.Reset} {
+				values := response.Header.Values(name)
+				if len(values) == 0 {
+					fatal(t, "missing rate limit header", append([]any{"header", name}, extra...)...)
+					return
+				}
+
+				if _, err := strconv.ParseUint(values[0], 10, 64); err != nil {
+					args := []any{"header", name, "value", values[0]}
+					args = append(args, extra...)
+					fatal(t, "rate limit header is not numeric", args...)
+				}
+			}
+		})
+	}
+}
+
+// ExpectRateLimited asserts that the response is a 429 Too Many Requests with
+// a valid Retry-After header, either a number of seconds or an HTTP date.
+func (h *HttpTester) ExpectRateLimited() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			equals(t, http.StatusTooManyRequests, response.StatusCode, extra...)
+
+			retryAfter := response.Header.Get("Retry-After")
+			if retryAfter == "" {
+				fatal(t, "missing Retry-After header", extra...)
+				return
+			}
+
+			if _, err := strconv.ParseUint(retryAfter, 10, 64); err == nil {
+				return
+			}
+
+			if _, err := http.ParseTime(retryAfter); err != nil {
+				args := []any{"value", retryAfter, "format", "seconds or " + http.TimeFormat}
+				args = append(args, extra...)
+				fatal(t, "Retry-After header is malformed", args...)
+			}
+		})
+	}
+}
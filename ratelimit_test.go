@@ -0,0 +1,35 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		for key, values := range request.URL.Query() {
+			writer.Header().Set(key, values[0])
+		}
+		writer.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?X-RateLimit-Limit=10&X-RateLimit-Remaining=0&X-RateLimit-Reset=30&Retry-After=30").
+			Expect(ht.ExpectRateLimitHeaders(), ht.ExpectRateLimited()).
+			Test()
+	})
+
+	expectFailure(t, "RateLimit-Reset", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?RateLimit-Limit=10&RateLimit-Remaining=0").
+			Expect(ht.ExpectRateLimitHeadersScheme(httptester.RateLimitDraftHeaders)).
+			Test()
+	})
+
+	expectFailure(t, "Retry-After header is malformed", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?Retry-After=soon").Expect(ht.ExpectRateLimited()).Test()
+	})
+}
@@ -0,0 +1,79 @@
+package httptester
+
+// Assertions against JSON Schema documents.
+
+import (
+	"github.com/xeipuuv/gojsonschema"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// WithJsonSchemaFS configures an HttpTester to load the schema files given to
+// ExpectJsonSchema from fsys, rather than from the OS. This suits schemas in an
+// embedded file system, e.g.:
+//
+//	//go:embed schemas
+//	var schemas embed.FS
+//
+//	ht := httptester.New(t, srv, httptester.WithJsonSchemaFS(schemas))
+func WithJsonSchemaFS(fsys fs.FS) TesterOption {
+	return func(tester *HttpTester) {
+		tester.jsonSchemaFS = fsys
+	}
+}
+
+// ExpectJsonSchema asserts that the HTTP response has a JSON body which is valid
+// according to a JSON Schema. schema is either the schema document itself, or
+// the path of a file containing it, loaded as per WithJsonSchemaFS. All
+// validation errors are reported together.
+func (h *HttpTester) ExpectJsonSchema(schema string) ResponseOption {
+	h.t.Helper()
+
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(h.loadJsonSchema(schema)))
+	must(h.t, err, "invalid JSON schema", schema)
+
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			result, err := compiled.Validate(gojsonschema.NewStringLoader(body))
+			must(t, err, append([]any{"cannot validate response against JSON schema", "full data", body}, extra...)...)
+
+			if !result.Valid() {
+				failures := make([]string, 0, len(result.Errors()))
+				for _, e := range result.Errors() {
+					failures = append(failures, e.String())
+				}
+
+				args := []any{strings.Join(failures, "\n"), "full data", body}
+				args = append(args, extra...)
+				fatal(t, "response does not match JSON schema", args...)
+			}
+		})
+	}
+}
+
+// loadJsonSchema returns schema if it is a JSON document, else the contents of
+// the file it names.
+func (h *HttpTester) loadJsonSchema(schema string) string {
+	h.t.Helper()
+
+	if trimmed := strings.TrimSpace(schema); strings.HasPrefix(trimmed, "{") || trimmed == "true" || trimmed == "false" {
+		return schema
+	}
+
+	var data []byte
+	var err error
+
+	if h.jsonSchemaFS != nil {
+		data, err = fs.ReadFile(h.jsonSchemaFS, schema)
+	} else {
+		data, err = os.ReadFile(schema)
+	}
+
+	must(h.t, err, "cannot read JSON schema file", schema)
+
+	return string(data)
+}
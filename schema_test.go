@@ -0,0 +1,37 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExpectJsonSchema(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"id":1,"name":"widget"}`))
+	})
+
+	schema := `{
+		"type": "object",
+		"required": ["id", "name"],
+		"properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+	}`
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectJsonSchema(schema)).Test()
+	})
+
+	expectFailure(t, "price is required", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectJsonSchema(`{"required": ["id", "price"]}`)).Test()
+	})
+
+	schemas := fstest.MapFS{"item.json": {Data: []byte(schema)}}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler, httptester.WithJsonSchemaFS(schemas))
+		ht.Request("GET", "/").Expect(ht.ExpectJsonSchema("item.json")).Test()
+	})
+}
@@ -0,0 +1,75 @@
+package httptester
+
+// Assertions against security policy.
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var (
+	// SecurityHeaders are the response headers required by ExpectSecurityHeaders,
+	// mapped to their required value. An empty value only requires the header
+	// to be present. This may be changed to suit your security policy, e.g.:
+	//
+	//	httptester.SecurityHeaders["Referrer-Policy"] = "no-referrer"
+	SecurityHeaders = map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "",
+		"Content-Security-Policy": "",
+	}
+
+	// TLSSecurityHeaders are additionally required by ExpectSecurityHeaders
+	// when the response is served over TLS, as per SecurityHeaders.
+	TLSSecurityHeaders = map[string]string{
+		"Strict-Transport-Security": "",
+	}
+)
+
+// ExpectSecurityHeaders asserts that the response has each of SecurityHeaders,
+// plus TLSSecurityHeaders if served over TLS. Values are compared
+// case-insensitively. All missing or misconfigured headers are reported
+// together.
+func (h *HttpTester) ExpectSecurityHeaders() ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			required := make(map[string]string, len(SecurityHeaders)+len(TLSSecurityHeaders))
+			for name, val := range SecurityHeaders {
+				required[name] = val
+			}
+
+			if response.TLS != nil {
+				for name, val := range TLSSecurityHeaders {
+					required[name] = val
+				}
+			}
+
+			names := make([]string, 0, len(required))
+			for name := range required {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			failures := make([]string, 0)
+
+			for _, name := range names {
+				values := response.Header.Values(name)
+				if len(values) == 0 {
+					failures = append(failures, fmt.Sprintf("%s: missing", name))
+				} else if expected := required[name]; expected != "" && !strings.EqualFold(values[0], expected) {
+					failures = append(failures, fmt.Sprintf("%s: expected %q, actual %q", name, expected, values[0]))
+				}
+			}
+
+			if len(failures) > 0 {
+				args := []any{strings.Join(failures, "\n")}
+				args = append(args, extra...)
+				fatal(t, "response does not have the required security headers", args...)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpectSecurityHeaders(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Content-Type-Options", "nosniff")
+		writer.Header().Set("X-Frame-Options", "DENY")
+		if !request.URL.Query().Has("nocsp") {
+			writer.Header().Set("Content-Security-Policy", "default-src 'self'")
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/").Expect(ht.ExpectSecurityHeaders()).Test()
+	})
+
+	expectFailure(t, "Content-Security-Policy: missing", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/?nocsp").Expect(ht.ExpectSecurityHeaders()).Test()
+	})
+
+	expectFailure(t, "Strict-Transport-Security: missing", func(tb httptester.TestingTB) {
+		srv := httptest.NewTLSServer(handler)
+		tb.Cleanup(srv.Close)
+
+		ht := httptester.New(tb, srv)
+		ht.Request("GET", "/").Expect(ht.ExpectSecurityHeaders()).Test()
+	})
+}
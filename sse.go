@@ -0,0 +1,181 @@
+package httptester
+
+// Assertions against Server-Sent Events streams.
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SSETimeout is how long ExpectSSE waits for all of its expected events.
+var SSETimeout = 5 * time.Second
+
+// SSEEvent is an event received from a Server-Sent Events stream.
+type SSEEvent struct {
+	// Type is the event's type, which is "message" unless set by the server.
+	Type string
+	Data string
+	ID   string
+}
+
+// SSEExpectation describes an event expected by ExpectSSE.
+type SSEExpectation struct {
+	// Type, if not empty, is the required type of the event.
+	Type string
+	// Options are tested against the event's data as if it were a response
+	// body, e.g. ExpectJsonMatch or CaptureJson.
+	Options []ResponseOption
+}
+
+// ExpectSSE asserts that the response is a Server-Sent Events stream whose
+// first events match events, in order. Only as many events as are expected are
+// read, so this is suitable for streams which do not end. Fails if they are not
+// received within SSETimeout. E.g.:
+//
+//	ht.Request("GET", "/events").Expect(ht.ExpectSSE(
+//		httptester.SSEExpectation{Type: "ready"},
+//		httptester.SSEExpectation{Options: []httptester.ResponseOption{ht.ExpectJsonMatch("$.progress", 50)}},
+//	)).Test()
+//
+// Captures given in events' options are captured from that event's data.
+func (h *HttpTester) ExpectSSE(events ...SSEExpectation) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		var reader *sseReader
+		var received []SSEEvent
+
+		expectation.bodyWrappers = append(expectation.bodyWrappers, func(t TestingTB, body io.Reader, sent time.Time) io.Reader {
+			reader = &sseReader{body: body, deadline: sent.Add(SSETimeout), remaining: len(events)}
+			return reader
+		})
+
+		eventExpectations := make([]*HttpExpectation, len(events))
+		for i, event := range events {
+			i := i
+
+			eventExpectations[i] = expectation.request.newExpectation()
+			for _, opt := range event.Options {
+				opt(eventExpectations[i])
+			}
+
+			for name, capture := range eventExpectations[i].captures {
+				capture := capture
+
+				expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+					t.Helper()
+
+					return capture(t, response, received[i].Data, append([]any{"SSE event", i + 1}, extra...)...)
+				}
+			}
+		}
+
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			contentType := response.Header.Get("Content-Type")
+			if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "text/event-stream" {
+				args := []any{"Content-Type", contentType}
+				args = append(args, extra...)
+				fatal(t, "response is not text/event-stream", args...)
+			}
+
+			received = parseSSE(body)
+
+			if len(received) < len(events) {
+				args := []any{"expected", len(events), "received", len(received), "timed out", reader.timedOut}
+				args = append(args, extra...)
+				fatal(t, "did not receive the expected number of SSE events", args...)
+				return
+			}
+
+			for i, event := range events {
+				eventExtra := append([]any{"SSE event", i + 1, "data", received[i].Data}, extra...)
+
+				if event.Type != "" && event.Type != received[i].Type {
+					args := []any{"expected", event.Type, "actual", received[i].Type}
+					args = append(args, eventExtra...)
+					fatal(t, "SSE event has the wrong type", args...)
+				}
+
+				for _, expect := range eventExpectations[i].responseExpectations {
+					expect(t, response, received[i].Data, eventExtra...)
+				}
+			}
+		})
+	}
+}
+
+// parseSSE parses the complete events in a Server-Sent Events stream.
+func parseSSE(stream string) []SSEEvent {
+	events := make([]SSEEvent, 0)
+	event, data := SSEEvent{}, make([]string, 0)
+
+	stream = strings.ReplaceAll(strings.ReplaceAll(stream, "\r\n", "\n"), "\r", "\n")
+
+	for _, line := range strings.SplitAfter(stream, "\n") {
+		if !strings.HasSuffix(line, "\n") {
+			// An incomplete line, as the stream was cut short.
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if line == "" {
+			if len(data) > 0 {
+				event.Data = strings.Join(data, "\n")
+				if event.Type == "" {
+					event.Type = "message"
+				}
+				events = append(events, event)
+			}
+
+			event, data = SSEEvent{}, make([]string, 0)
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Type = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		}
+	}
+
+	return events
+}
+
+// sseReader reads a Server-Sent Events stream until it has received remaining
+// events, or its deadline passes.
+type sseReader struct {
+	body      io.Reader
+	deadline  time.Time
+	remaining int
+	pending   string
+	timedOut  bool
+	done      bool
+}
+
+func (s *sseReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	}
+
+	n, timedOut, err := readWithin(s.body, p, s.deadline)
+	if timedOut {
+		s.timedOut, s.done = true, true
+		return 0, io.EOF
+	}
+
+	s.pending += string(p[:n])
+	if events := parseSSE(s.pending); len(events) >= s.remaining {
+		s.done = true
+	}
+
+	return n, err
+}
@@ -0,0 +1,50 @@
+package httptester_test
+
+import (
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpectSSE(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/event-stream")
+
+		_, _ = writer.Write([]byte("event: ready\ndata: {}\n\n: comment\ndata: {\"progress\":50,\ndata: \"id\":\"job-1\"}\n\n"))
+		writer.(http.Flusher).Flush()
+
+		// Never end the stream.
+		<-request.Context().Done()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		captures := ht.Request("GET", "/events").Expect(ht.ExpectSSE(
+			httptester.SSEExpectation{Type: "ready"},
+			httptester.SSEExpectation{Type: "message", Options: []httptester.ResponseOption{
+				ht.ExpectJsonMatch("$.progress", 50),
+				ht.CaptureJson("job", "$.id"),
+			}},
+		)).Test()
+
+		if captures["job"] != "job-1" {
+			t.Errorf("unexpected captures: %v", captures)
+		}
+	})
+
+	expectFailure(t, "SSE event has the wrong type", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/events").Expect(ht.ExpectSSE(httptester.SSEExpectation{Type: "done"})).Test()
+	})
+
+	httptester.SSETimeout = 50 * time.Millisecond
+	defer func() { httptester.SSETimeout = 5 * time.Second }()
+
+	expectFailure(t, "did not receive the expected number of SSE events", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/events").Expect(ht.ExpectSSE(
+			httptester.SSEExpectation{}, httptester.SSEExpectation{}, httptester.SSEExpectation{},
+		)).Test()
+	})
+}
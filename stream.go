@@ -0,0 +1,248 @@
+package httptester
+
+// Support for streaming responses.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+)
+
+// StreamReadTimeout is how long each read from a stream returned by
+// HttpExpectation.TestStream waits for data before failing the test.
+var StreamReadTimeout = 5 * time.Second
+
+// MaxBodyBytes configures an HttpExpectation to fail as soon as more than n
+// bytes of the response body are read. Unlike ExpectMaxBodySize, this stops a
+// runaway stream as it is read, so also applies to HttpExpectation.TestStream.
+func (h *HttpTester) MaxBodyBytes(n int64) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.bodyWrappers = append(expectation.bodyWrappers, func(t TestingTB, body io.Reader, sent time.Time) io.Reader {
+			return &maxBytesReader{t: t, body: body, remaining: n, limit: n}
+		})
+	}
+}
+
+// maxBytesReader fails the test once more than limit bytes are read from body.
+type maxBytesReader struct {
+	t         TestingTB
+	body      io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	n, err := m.body.Read(p)
+
+	if m.remaining -= int64(n); m.remaining < 0 {
+		m.t.Helper()
+		fatal(m.t, fmt.Sprintf("response body exceeded %d bytes", m.limit))
+	}
+
+	return n, err
+}
+
+// TestStream executes the associated request, but unlike Test, returns the
+// response body for the caller to read rather than reading it to EOF. This
+// suits streaming responses which may not end. Each read fails the test if no
+// data arrives within StreamReadTimeout.
+//
+// Expectations of the response's status and headers, e.g. ExpectCode and
+// ExpectHeader, are tested before the stream is returned. All others, and
+// captures, are tested once the stream is closed, against the part of the body
+// which was read. The response's duration, as tested by ExpectFasterThan, is
+// the time until the stream is closed. The test fails if the stream is not
+// closed. E.g.:
+//
+//	stream := ht.Request("GET", "/feed").Expect(ht.ExpectCode(200), ht.MaxBodyBytes(1<<20)).TestStream()
+//	line, _ := bufio.NewReader(stream).ReadString('\n')
+//	stream.Close()
+func (h *HttpExpectation) TestStream(extra ...any) io.ReadCloser {
+	tester := h.request.tester
+	tester.t.Helper()
+
+	h.request.done = true
+
+	var stream *streamBody
+
+	h.request.named(func() {
+		tester.t.Helper()
+
+		stream = h.openStream(extra...)
+	})
+
+	if stream == nil {
+		// The subtest failed, so there is nothing to read.
+		return io.NopCloser(strings.NewReader(""))
+	}
+
+	tester.t.Cleanup(func() {
+		if stream.closed {
+			return
+		}
+
+		_ = stream.response.Body.Close()
+		stream.cancel()
+
+		if !stream.aborted {
+			fatal(tester.t, "stream returned by TestStream was never closed", stream.extra...)
+		}
+	})
+
+	return stream
+}
+
+// openStream finalises and sends the request, testing its header expectations
+// and returning its body as a stream.
+func (h *HttpExpectation) openStream(extra ...any) *streamBody {
+	tester := h.request.tester
+	tester.t.Helper()
+
+	h.request.finalise(extra...)
+
+	r, extra := h.begin(extra...)
+
+	start := time.Now()
+	resp, cancel := h.request.do(tester.t, r, extra...)
+
+	// Release the response if its header expectations fail.
+	opened := false
+	defer func() {
+		if !opened {
+			_ = resp.Body.Close()
+			cancel()
+		}
+	}()
+
+	var body io.Reader = &streamTimeoutReader{t: tester.t, body: resp.Body}
+	if !h.keepCompressed {
+		body = decompress(resp, body)
+	}
+
+	for _, wrap := range h.bodyWrappers {
+		body = wrap(tester.t, body, start)
+	}
+
+	if respData, err := httputil.DumpResponse(resp, false); err == nil {
+		extra = append(extra, "HTTP response:", string(respData))
+	}
+
+	for i, expectation := range h.responseExpectations {
+		if h.headerExpectations[i] {
+			expectation(tester.t, resp, "", extra...)
+		}
+	}
+
+	opened = true
+
+	return &streamBody{expectation: h, response: resp, body: body, cancel: cancel, extra: extra, sent: start}
+}
+
+// streamTimeoutReader fails the test if a read from body does not complete
+// within StreamReadTimeout.
+type streamTimeoutReader struct {
+	t    TestingTB
+	body io.Reader
+}
+
+func (s *streamTimeoutReader) Read(p []byte) (int, error) {
+	n, timedOut, err := readWithin(s.body, p, time.Now().Add(StreamReadTimeout))
+	if timedOut {
+		s.t.Helper()
+		fatal(s.t, fmt.Sprintf("no data received from stream within %s", StreamReadTimeout))
+	}
+
+	return n, err
+}
+
+// streamBody is returned by HttpExpectation.TestStream, recording the body as it
+// is read so that expectations can be tested once it is closed.
+type streamBody struct {
+	expectation *HttpExpectation
+	response    *http.Response
+	body        io.Reader
+	read        bytes.Buffer
+	cancel      func()
+	extra       []any
+	sent        time.Time
+	closed      bool
+	// aborted is set if a read failed the test, in which case the stream is
+	// not expected to be closed.
+	aborted bool
+}
+
+func (s *streamBody) Read(p []byte) (int, error) {
+	s.aborted = true
+	n, err := s.body.Read(p)
+	s.aborted = false
+
+	s.read.Write(p[:n])
+
+	return n, err
+}
+
+// Close closes the response body, then tests the request's remaining
+// expectations and captures.
+func (s *streamBody) Close() error {
+	tester := s.expectation.request.tester
+	tester.t.Helper()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	err := s.response.Body.Close()
+	s.cancel()
+	s.expectation.duration = time.Since(s.sent)
+
+	body := s.read.String()
+	s.response.Body = io.NopCloser(bytes.NewBufferString(body))
+
+	extra := append([]any{"body read from stream:", excerpt(body, 0)}, s.extra...)
+
+	for i, expectation := range s.expectation.responseExpectations {
+		if !s.expectation.headerExpectations[i] {
+			expectation(tester.t, s.response, body, extra...)
+		}
+	}
+
+	for name, capture := range s.expectation.captures {
+		tester.captures[name] = capture(tester.t, s.response, body, extra...)
+	}
+
+	s.expectation.request.passed = true
+
+	return err
+}
+
+// readWithin reads from r into p, giving up if the read does not complete by
+// deadline. The read is made in the background, so a read which times out
+// continues until r is closed, and its data is discarded.
+func readWithin(r io.Reader, p []byte, deadline time.Time) (n int, timedOut bool, err error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		buf := make([]byte, len(p))
+		n, err := r.Read(buf)
+		results <- result{buf[:n], err}
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case res := <-results:
+		return copy(p, res.data), false, res.err
+	case <-timer.C:
+		return 0, true, nil
+	}
+}
@@ -0,0 +1,99 @@
+package httptester_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"github.com/vaeryn-uk/go-httptester"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTestStream(t *testing.T) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Feed", "live")
+
+		if request.URL.Path == "/gzip" {
+			writer.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(writer)
+			_, _ = gz.Write([]byte("line 0\n"))
+			_ = gz.Flush()
+			writer.(http.Flusher).Flush()
+			<-request.Context().Done()
+			return
+		}
+
+		for i := 0; request.Context().Err() == nil; i++ {
+			_, _ = fmt.Fprintf(writer, "line %d\n", i)
+			writer.(http.Flusher).Flush()
+
+			if request.URL.Path == "/stalls" && i == 0 {
+				<-request.Context().Done()
+			}
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		stream := ht.Request("GET", "/feed").
+			Expect(ht.ExpectHeader("X-Feed", "live"), ht.ExpectBodyContains("line 0")).
+			TestStream()
+
+		line, err := bufio.NewReader(stream).ReadString('\n')
+		if err != nil || line != "line 0\n" {
+			t.Errorf("unexpected line %q: %v", line, err)
+		}
+
+		_ = stream.Close()
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		stream := ht.Request("GET", "/gzip", ht.Header("Accept-Encoding", "gzip")).
+			Name("gzip feed").
+			Expect(ht.ExpectBodyContains("line 0")).
+			TestStream()
+
+		line, err := bufio.NewReader(stream).ReadString('\n')
+		if err != nil || line != "line 0\n" {
+			t.Errorf("unexpected line %q: %v", line, err)
+		}
+
+		_ = stream.Close()
+	})
+
+	// Header expectations fail before the stream is read.
+	expectFailure(t, "response header does not have the expected value", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/feed").Expect(ht.ExpectHeader("X-Feed", "dead")).TestStream()
+		tb.Fatal("stream was returned")
+	})
+
+	expectFailure(t, "response was too slow", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		stream := ht.Request("GET", "/feed").Expect(ht.ExpectFasterThan(10 * time.Millisecond)).TestStream()
+		time.Sleep(30 * time.Millisecond)
+		_ = stream.Close()
+	})
+
+	expectFailure(t, "stream returned by TestStream was never closed", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/feed").Expect(ht.ExpectBodyContains("line 0")).TestStream()
+	})
+
+	expectFailure(t, "response body exceeded 100 bytes", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.Request("GET", "/feed").Expect(ht.MaxBodyBytes(100)).Test()
+	})
+
+	httptester.StreamReadTimeout = 50 * time.Millisecond
+	defer func() { httptester.StreamReadTimeout = 5 * time.Second }()
+
+	expectFailure(t, "no data received from stream within 50ms", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		stream := ht.Request("GET", "/stalls").Expect().TestStream()
+		_, _ = io.ReadAll(stream)
+	})
+}
@@ -0,0 +1,121 @@
+package httptester
+
+// Support for testing WebSocket endpoints.
+
+import (
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WebSocketReadTimeout is how long WsTester.ExpectJson waits for a message.
+var WebSocketReadTimeout = 5 * time.Second
+
+// WsTester tests a WebSocket connection opened by HttpTester.WebSocket.
+type WsTester struct {
+	tester    *HttpTester
+	request   *HttpTesterRequest
+	conn      *websocket.Conn
+	handshake *http.Response
+}
+
+// WebSocket connects to the WebSocket endpoint at path, configured by options
+// as per Request. Fails if the connection cannot be opened. The connection is
+// closed when the test finishes, if not before. E.g.:
+//
+//	ws := ht.WebSocket("/ws", ht.Bearer(token))
+//	ws.SendJson(map[string]any{"type": "subscribe"})
+//	ws.ExpectJson(ht.ExpectJsonMatch("$.type", "subscribed"))
+func (h *HttpTester) WebSocket(path string, options ...RequestOption) *WsTester {
+	h.t.Helper()
+
+	req := h.Request(http.MethodGet, path, options...)
+	req.done = true
+	req.finalise()
+
+	u := *req.request.URL
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+
+	dialer := *websocket.DefaultDialer
+	dialer.Jar = h.client.Jar
+	if transport, isTransport := h.client.Transport.(*http.Transport); isTransport {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+
+	conn, handshake, err := dialer.Dial(u.String(), req.request.Header)
+	if err != nil {
+		args := []any{"url", u.String(), "error", err}
+		if handshake != nil {
+			args = append(args, "status", handshake.Status)
+		}
+		fatal(h.t, "failed to open WebSocket connection", args...)
+		return nil
+	}
+
+	h.t.Cleanup(func() { _ = conn.Close() })
+	req.passed = true
+
+	return &WsTester{tester: h, request: req, conn: conn, handshake: handshake}
+}
+
+// SendJson sends data as a JSON text message.
+func (w *WsTester) SendJson(data any, extra ...any) {
+	w.tester.t.Helper()
+
+	must(w.tester.t, w.conn.WriteJSON(data), append([]any{"failed to send WebSocket message"}, extra...)...)
+}
+
+// ExpectJson reads the next message, which must be JSON, and tests it against
+// options as if it were a response body. The response's status and headers
+// are those of the WebSocket handshake. Returns any captures, as per
+// HttpExpectation.Test. Fails if no message arrives within
+// WebSocketReadTimeout.
+func (w *WsTester) ExpectJson(options ...ResponseOption) (captures map[string]string) {
+	t := w.tester.t
+	t.Helper()
+
+	must(t, w.conn.SetReadDeadline(time.Now().Add(WebSocketReadTimeout)))
+
+	_, data, err := w.conn.ReadMessage()
+	must(t, err, "failed to read WebSocket message")
+
+	body := string(data)
+	extra := []any{"WebSocket message:", body}
+	MustParseJson[any](t, strings.NewReader(body), extra...)
+
+	expectation := w.request.newExpectation()
+
+	for _, opt := range options {
+		opt(expectation)
+	}
+
+	response := *w.handshake
+	response.Body = io.NopCloser(strings.NewReader(body))
+
+	for _, expect := range expectation.responseExpectations {
+		expect(t, &response, body, extra...)
+	}
+
+	captures = make(map[string]string)
+
+	for name, capture := range expectation.captures {
+		captures[name] = capture(t, &response, body, extra...)
+		w.tester.captures[name] = captures[name]
+	}
+
+	return captures
+}
+
+// Close closes the connection, first sending a close message to the server.
+func (w *WsTester) Close() {
+	w.tester.t.Helper()
+
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := w.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil && err != websocket.ErrCloseSent {
+		fatal(w.tester.t, "failed to close WebSocket connection", err)
+	}
+
+	must(w.tester.t, w.conn.Close())
+}
@@ -0,0 +1,52 @@
+package httptester_test
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/vaeryn-uk/go-httptester"
+	"net/http"
+	"testing"
+)
+
+func TestWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var msg map[string]any
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			_ = conn.WriteJSON(map[string]any{"type": "echo", "payload": msg})
+		}
+	})
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+
+		ws := ht.WebSocket("/ws", ht.Bearer("token"))
+		ws.SendJson(map[string]any{"id": "1"})
+		captures := ws.ExpectJson(ht.ExpectJsonMatch("$.type", "echo"), ht.CaptureJson("id", "$.payload.id"))
+		ws.Close()
+
+		if captures["id"] != "1" {
+			t.Errorf("unexpected captures: %v", captures)
+		}
+	})
+
+	expectFailure(t, "failed to open WebSocket connection", func(tb httptester.TestingTB) {
+		ht := newTester(tb, handler)
+		ht.WebSocket("/ws")
+	})
+}
@@ -0,0 +1,78 @@
+package httptester
+
+// Support for XML requests and responses.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/antchfx/xmlquery"
+	"net/http"
+	"strings"
+)
+
+// XmlBody configures a HttpTesterRequest with an XML body. If body is a string
+// or io.Reader, it is sent as is, else it is converted via xml.Marshal.
+//
+// "application/xml" is set as the request content type.
+func (h *HttpTester) XmlBody(body any) RequestOption {
+	h.t.Helper()
+
+	bodyStr, isStr := h.stringifyReader(body)
+
+	if !isStr {
+		b, err := xml.Marshal(body)
+		must(h.t, err, "cannot convert body data to XML", body)
+		bodyStr = string(b)
+	}
+
+	return func(req *HttpTesterRequest) {
+		req.request.Header.Set("Content-Type", "application/xml")
+		req.setBody("XmlBody()", strings.NewReader(bodyStr))
+	}
+}
+
+// ExpectXmlMatch asserts that the HTTP response has an XML body in which the
+// first node matching xpath has the text expected.
+func (h *HttpTester) ExpectXmlMatch(xpath, expected string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.addExpectation(func(t TestingTB, response *http.Response, body string, extra ...any) {
+			t.Helper()
+
+			extra = append([]any{fmt.Sprintf("xpath: %s", xpath)}, extra...)
+			equals(t, expected, XmlContains(t, body, xpath, extra...), extra...)
+		})
+	}
+}
+
+// CaptureXml defines a capture of the text of the first node matching xpath in
+// the response's XML body. Will fatal if nothing matches.
+func (h *HttpTester) CaptureXml(name, xpath string) ResponseOption {
+	return func(expectation *HttpExpectation) {
+		expectation.captures[name] = func(t TestingTB, response *http.Response, body string, extra ...any) string {
+			t.Helper()
+
+			return XmlContains(t, body, xpath, extra...)
+		}
+	}
+}
+
+// XmlContains fatals the test if the provided XML data has no node matching
+// xpath. Returns the text of the first matching node.
+func XmlContains(t TestingTB, data string, xpath string, extra ...any) string {
+	t.Helper()
+
+	doc, err := xmlquery.Parse(strings.NewReader(data))
+	must(t, err, append([]any{"failed to parse XML"}, extra...)...)
+
+	node, err := xmlquery.Query(doc, xpath)
+	must(t, err, append([]any{"invalid xpath", xpath}, extra...)...)
+
+	if node == nil {
+		args := []any{"xpath", xpath, "full data", data}
+		args = append(args, extra...)
+		fatal(t, "xpath does not match any node", args...)
+		return ""
+	}
+
+	return node.InnerText()
+}
@@ -0,0 +1,35 @@
+package httptester_test
+
+import (
+	"encoding/xml"
+	"github.com/vaeryn-uk/go-httptester"
+	"testing"
+)
+
+func TestXml(t *testing.T) {
+	type user struct {
+		XMLName xml.Name `xml:"user"`
+		ID      string   `xml:"id,attr"`
+		Name    string   `xml:"name"`
+	}
+
+	expectPass(t, func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		captures := ht.Request("POST", "/", ht.XmlBody(user{ID: "42", Name: "Scotty"})).
+			Expect(
+				ht.ExpectContentType("application/xml"),
+				ht.ExpectXmlMatch("/user/name", "Scotty"),
+				ht.CaptureXml("id", "/user/@id"),
+			).
+			Test()
+
+		if captures["id"] != "42" {
+			t.Errorf("unexpected captures: %v", captures)
+		}
+	})
+
+	expectFailure(t, "xpath does not match any node", func(tb httptester.TestingTB) {
+		ht := newTester(tb, echoHandler())
+		ht.Request("POST", "/", ht.XmlBody(`<user><name>Scotty</name></user>`)).Expect(ht.ExpectXmlMatch("//email", "")).Test()
+	})
+}